@@ -3,18 +3,21 @@ module main
 go 1.17
 
 require (
+	github.com/golang/snappy v0.0.4
+	github.com/google/gopacket v1.1.19
+	github.com/jhump/protoreflect v1.12.0
+	github.com/klauspost/compress v1.15.15
 	google.golang.org/grpc v1.43.0
 	google.golang.org/protobuf v1.27.1
 )
 
 require (
 	github.com/golang/protobuf v1.5.2 // indirect
-	github.com/psanford/lencode v0.3.0 // indirect
 	github.com/salrashid123/grpc_wireformat/grpc_services/src/echo v0.0.0
-	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4 // indirect
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
 	golang.org/x/sys v0.0.0-20210510120138-977fb7262007 // indirect
 	golang.org/x/text v0.3.5 // indirect
-	google.golang.org/genproto v0.0.0-20211223182754-3ac035c7e7cb // indirect
+	google.golang.org/genproto v0.0.0-20211223182754-3ac035c7e7cb
 )
 
 require github.com/gogo/protobuf v1.3.2 // indirect
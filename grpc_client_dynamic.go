@@ -2,232 +2,486 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
-	"github.com/psanford/lencode"
 	"golang.org/x/net/http2"
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
-	"google.golang.org/protobuf/reflect/protoregistry"
-	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/dynamicpb"
-	"google.golang.org/protobuf/types/known/anypb"
+
+	"main/grpctrace"
+	"main/protoset"
+	"main/wireformat"
 
 	"net/http"
 )
 
-const ()
+const (
+	// delay between the messages sent to client streaming and bidi methods
+	streamSendInterval = 500 * time.Millisecond
+)
 
 var (
-	cacert     = flag.String("cacert", "grpc_services/certs/tls-ca-chain.pem", "CACert for server")
-	url        = flag.String("url", "https://localhost:50051/echo.EchoServer/SayHello", "gRPC server fully qualified")
-	serverName = flag.String("servername", "localhost", "SNI for server")
+	cacert      = flag.String("cacert", "grpc_services/certs/tls-ca-chain.pem", "CACert for server")
+	url         = flag.String("url", "https://localhost:50051", "gRPC server base url")
+	protosets   = flag.String("protoset", "grpc_services/src/echo/echo.pb", "comma separated FileDescriptorSet (.pb) files describing the service")
+	protoFiles  = flag.String("proto", "", "comma separated .proto files to compile instead of reading --protoset")
+	importPath  = flag.String("import-path", "", "comma separated directories to resolve --proto files and their imports in")
+	useReflect  = flag.Bool("reflect", false, "download the service's descriptors from the server's reflection service instead of reading --protoset")
+	method      = flag.String("method", "echo.EchoServer/SayHello", "method to call as package.Service/Method")
+	data        = flag.String("d", `{"firstName": "sal", "lastName": "mander", "middleName": {"name": "a"}}`, "request message as JSON; client streaming methods take a sequence of JSON objects, one per message")
+	serverName  = flag.String("servername", "localhost", "SNI for server")
+	clientCert  = flag.String("cert", "", "client certificate for mTLS")
+	clientKey   = flag.String("key", "", "client key for mTLS")
+	unixSocket  = flag.String("unix", "", "path of a unix domain socket to dial instead of the url's host")
+	authority   = flag.String("authority", "", "value for the :authority pseudo-header; defaults to the url's host")
+	plaintext   = flag.Bool("plaintext", false, "use cleartext HTTP/2 (h2c) for servers started with --insecure; implied by an http:// url")
+	traceFrames = flag.Bool("trace-frames", false, "log every HTTP/2 frame sent and received to stderr")
+	keyLog      = flag.String("keylog", os.Getenv("SSLKEYLOGFILE"), "append the TLS secrets to this file in NSS key log format so captures can be decrypted; defaults to $SSLKEYLOGFILE")
+
+	headers headerFlags
+
+	maxRecvMsgSize = flag.Int("maxRecvMsgSize", wireformat.DefaultMaxMessageSize, "maximum size in bytes of a received message")
+	maxSendMsgSize = flag.Int("maxSendMsgSize", wireformat.DefaultMaxMessageSize, "maximum size in bytes of a sent message")
+	timeout        = flag.Duration("timeout", 0, "deadline for the RPC, sent as grpc-timeout (eg 500ms); 0 waits forever")
+	compressor     = flag.String("compressor", "", "grpc-encoding to compress the request with (gzip, deflate, snappy, zstd, identity); empty sends uncompressed")
+
+	// dynamicpb messages are serialized in random field order unless deterministic
+	marshalOptions = proto.MarshalOptions{Deterministic: true}
 )
 
+// headerFlags collects repeated -H key:value flags
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
 func main() {
 
+	flag.Var(&headers, "H", "custom metadata as key:value, may be repeated; values of -bin keys are base64 encoded for you")
 	flag.Parse()
 
-	// read the .pb files and register those message types
-	pbFiles := []string{
-		"grpc_services/src/echo/echo.pb",
+	// set up the connection
+	// with --plaintext (or an http:// url) talk cleartext HTTP/2 with prior knowledge (h2c)
+	// use this if you want to run the grpc server with the --insecure flag and capture the tcp traces with wireshark
+	// https://medium.com/@thrawn01/http-2-cleartext-h2c-client-example-in-go-8167c7a4181e
+	baseURL := strings.TrimSuffix(*url, "/")
+	// with --unix every connection goes to the socket; the url's host is only used for :authority
+	dial := net.Dial
+	if *unixSocket != "" {
+		dial = func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", *unixSocket)
+		}
 	}
-
-	for _, fileName := range pbFiles {
-
-		protoFile, err := ioutil.ReadFile(fileName)
+	var transport *http2.Transport
+	if *plaintext || strings.HasPrefix(baseURL, "http://") {
+		if strings.HasPrefix(baseURL, "https://") {
+			baseURL = "http://" + strings.TrimPrefix(baseURL, "https://")
+		}
+		transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return dial(network, addr)
+			},
+		}
+	} else {
+		// or load and use TLS
+		caCert, err := ioutil.ReadFile(*cacert)
 		if err != nil {
-			panic(err)
+			log.Fatalf("did not load ca: %v", err)
 		}
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(caCert)
 
-		fileDescriptors := &descriptorpb.FileDescriptorSet{}
-		err = proto.Unmarshal(protoFile, fileDescriptors)
-		if err != nil {
-			panic(err)
+		tlsConfig := tls.Config{
+			ServerName: *serverName,
+			RootCAs:    caCertPool,
 		}
-		for _, pb := range fileDescriptors.GetFile() {
-			var fdr protoreflect.FileDescriptor
-			fdr, err = protodesc.NewFile(pb, protoregistry.GlobalFiles)
+		if *clientCert != "" || *clientKey != "" {
+			certificate, err := tls.LoadX509KeyPair(*clientCert, *clientKey)
 			if err != nil {
-				panic(err)
+				log.Fatalf("could not load client key pair: %v", err)
 			}
-			fmt.Printf("Loading package %s\n", fdr.Package().Name())
-			err = protoregistry.GlobalFiles.RegisterFile(fdr)
+			tlsConfig.Certificates = []tls.Certificate{certificate}
+		}
+		// the key log is what lets wireshark or grpc_trace decrypt a capture of this connection
+		if *keyLog != "" {
+			f, err := os.OpenFile(*keyLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
 			if err != nil {
-				panic(err)
+				log.Fatalf("could not open key log: %v", err)
 			}
-			for _, m := range pb.MessageType {
-
-				fmt.Printf("  Registering MessageType: %s\n", *m.Name)
-				md := fdr.Messages().ByName(protoreflect.Name(*m.Name))
-				mdType := dynamicpb.NewMessageType(md)
-
-				err = protoregistry.GlobalTypes.RegisterMessage(mdType)
+			defer f.Close()
+			tlsConfig.KeyLogWriter = f
+		}
+		transport = &http2.Transport{
+			TLSClientConfig: &tlsConfig,
+		}
+		// http2.Transport dials TLS itself unless there's a connection to wrap
+		if *unixSocket != "" || *traceFrames {
+			transport.DialTLS = func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				conn, err := dial(network, addr)
 				if err != nil {
-					panic(err)
+					return nil, err
 				}
+				tlsConn := tls.Client(conn, cfg)
+				if err := tlsConn.Handshake(); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return tlsConn, nil
 			}
 		}
 	}
 
-	// first create the echo.Middle Message
-	echoRequestInnerMessageType, err := protoregistry.GlobalTypes.FindMessageByName("echo.Middle")
-	if err != nil {
-		panic(err)
+	// with --trace-frames the connection is wrapped to log what goes over it once any TLS is stripped
+	if *traceFrames {
+		dialTLS := transport.DialTLS
+		transport.DialTLS = func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			conn, err := dialTLS(network, addr, cfg)
+			if err != nil {
+				return nil, err
+			}
+			return grpctrace.LogFrames(conn, os.Stderr), nil
+		}
 	}
-	echoRequestInnerMessageDescriptor := echoRequestInnerMessageType.Descriptor()
-	// add a field
-	inner_name := echoRequestInnerMessageDescriptor.Fields().ByName("name")
-	reflectEchoInnerRequest := echoRequestInnerMessageType.New()
-	reflectEchoInnerRequest.Set(inner_name, protoreflect.ValueOfString("a"))
 
-	// now create the outer EchoRequest message
-	echoRequestMessageType, err := protoregistry.GlobalTypes.FindMessageByName("echo.EchoRequest")
-	if err != nil {
-		panic(err)
+	client := http.Client{
+		Transport: transport,
+	}
+	// every request carries the same :authority and metadata
+	do := func(req *http.Request) (*http.Response, error) {
+		addHeaders(req)
+		return client.Do(req)
 	}
-	echoRequestMessageDescriptor := echoRequestMessageType.Descriptor()
-
-	fname := echoRequestMessageDescriptor.Fields().ByName("first_name")
-	lname := echoRequestMessageDescriptor.Fields().ByName("last_name")
-	mname := echoRequestMessageDescriptor.Fields().ByName("middle_name")
 
-	// now add the fileds and the Middle message
-	// note the types, the message is of type Message
-	reflectEchoRequest := echoRequestMessageType.New()
-	reflectEchoRequest.Set(fname, protoreflect.ValueOfString("sal"))
-	reflectEchoRequest.Set(lname, protoreflect.ValueOfString("mander"))
-	reflectEchoRequest.Set(mname, protoreflect.ValueOfMessage(reflectEchoInnerRequest))
-	fmt.Printf("EchoRequest: %v\n", reflectEchoRequest)
+	// with --timeout the deadline goes to the server as grpc-timeout and the stream is reset when it passes
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
 
-	in, err := proto.Marshal(reflectEchoRequest.Interface())
+	// read the .pb files, compile the --proto sources or with --reflect download them
+	// from the server, and register their files and message types, imports first.
+	// they go in a private registry so they can't clash with generated code linked into the binary
+	reg := protoset.NewRegistry()
+	var fds []protoreflect.FileDescriptor
+	var err error
+	if *useReflect {
+		fds, err = reg.LoadReflection(ctx, do, baseURL, serviceName(*method))
+	} else if *protoFiles != "" {
+		var paths []string
+		if *importPath != "" {
+			paths = strings.Split(*importPath, ",")
+		}
+		fds, err = reg.Compile(paths, strings.Split(*protoFiles, ",")...)
+	} else {
+		fds, err = reg.Load(strings.Split(*protosets, ",")...)
+	}
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
+	}
+	for _, fd := range fds {
+		fmt.Printf("Loading package %s from %s\n", fd.Package(), fd.Path())
+		for i := 0; i < fd.Messages().Len(); i++ {
+			fmt.Printf("  Registering MessageType: %s\n", fd.Messages().Get(i).Name())
+		}
 	}
 
-	fmt.Printf("Encoded EchoRequest using protoreflect %s\n", hex.EncodeToString(in))
-
-	// if you wanted to use the actual generated go proto to verify the bytes
-	// import echo "github.com/salrashid123/grpc_wireformat/grpc_services/src/echo"
-	// eresp := &echo.EchoRequest{}
-	// err = proto.Unmarshal(in, eresp)
-	// if err != nil {
-	// 	panic(err)
-	// }
-	// fmt.Printf("Unmarshalled using proto %s\n", eresp.FirstName)
-
-	// first we're going to generate it by hand and compare it to the manually "typed" format
-	j := `{	"@type": "echo.EchoRequest", "firstName": "sal", "lastName": "mander", "middleName": { "name": "a"}}`
-	a, err := anypb.New(echoRequestMessageType.New().Interface())
+	// resolve the request and response types from the service definition
+	md, err := reg.FindMethod(*method)
 	if err != nil {
-		panic(err)
+		log.Fatalf("method %s not found: %v", *method, err)
 	}
+	fmt.Printf("Calling %s (%s) returns (%s)\n", md.FullName(), md.Input().FullName(), md.Output().FullName())
 
-	err = protojson.Unmarshal([]byte(j), a)
+	// build the request messages from JSON using the descriptor alone; see the README for
+	// setting the fields one by one through protoreflect instead
+	reqMessages, err := parseRequests(reg, md.Input(), *data)
 	if err != nil {
-		panic(err)
+		log.Fatalf("could not parse request JSON: %v", err)
+	}
+	if !md.IsStreamingClient() && len(reqMessages) != 1 {
+		log.Fatalf("%s takes exactly one request message, got %d", md.FullName(), len(reqMessages))
 	}
-	fmt.Printf("Encoded EchoRequest using protojson and anypb %v\n", hex.EncodeToString(a.Value))
 
 	var out bytes.Buffer
-	enc := lencode.NewEncoder(&out, lencode.SeparatorOpt([]byte{0}))
-	// to send the json->protobuf message
-	err = enc.Encode(a.Value)
+	if !md.IsStreamingClient() {
+		in, err := marshalOptions.Marshal(reqMessages[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Encoded request %s\n", hex.EncodeToString(in))
 
-	// to send the manually generated message:
-	//err = enc.Encode(in)
-	if err != nil {
-		panic(err)
+		enc := wireformat.NewEncoder(&out)
+		configureEncoder(enc)
+		err = enc.EncodeMessage(in)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("wire encoded request %s\n", hex.EncodeToString(out.Bytes()))
 	}
 
-	fmt.Printf("wire encoded EchoRequest: %s\n", hex.EncodeToString(out.Bytes()))
-
 	// make the grpc call
-	// fake out the TLS  if you want to decode using wireshark
-	// https://medium.com/@thrawn01/http-2-cleartext-h2c-client-example-in-go-8167c7a4181e
-	// use this if you want to run the grpc server with the --insecure flag and capture the tcp traces with wireshark
-	// client := http.Client{
-	// 	Transport: &http2.Transport{
-	// 		AllowHTTP: true,
-	// 		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-	// 			return net.Dial(network, addr)
-	// 		},
-	// 	},
-	// }
-
-	// or load and use TLS
-	caCert, err := ioutil.ReadFile(*cacert)
+	reqURL := baseURL + "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+	req, err := wireformat.NewRequest(ctx, reqURL, nil)
 	if err != nil {
-		log.Fatalf("did not load ca: %v", err)
+		log.Fatal(err)
 	}
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
 
-	tlsConfig := tls.Config{
-		ServerName: *serverName,
-		RootCAs:    caCertPool,
+	if md.IsStreamingClient() {
+		// client and bidi streaming send frames over time through a pipe; closing it half-closes the stream
+		stream := wireformat.NewRequestStream()
+		configureEncoder(stream.Encoder())
+		go func() {
+			for i, m := range reqMessages {
+				b, err := marshalOptions.Marshal(m)
+				if err != nil {
+					stream.CloseWithError(err)
+					return
+				}
+				fmt.Printf("Sending request %d: %s\n", i+1, hex.EncodeToString(b))
+				err = stream.Send(b)
+				if err != nil {
+					log.Printf("could not send request: %v", err)
+					stream.CloseWithError(err)
+					return
+				}
+				time.Sleep(streamSendInterval)
+			}
+			fmt.Printf("Half-closing request stream\n")
+			stream.CloseSend()
+		}()
+		req.Body = stream
+	} else {
+		req.Body = io.NopCloser(bytes.NewReader(out.Bytes()))
+		req.ContentLength = int64(out.Len())
 	}
 
-	client := http.Client{
-		Transport: &http2.Transport{
-			TLSClientConfig: &tlsConfig,
-		},
+	if *compressor != "" {
+		req.Header.Set("grpc-encoding", *compressor)
 	}
-
-	reader := bytes.NewReader(out.Bytes())
-	resp, err := client.Post(*url, "application/grpc", reader)
+	resp, err := do(req)
 	if err != nil {
-		log.Fatal(err)
+		rpcFailed(wireformat.ContextError(ctx, err))
 	}
-	if resp.StatusCode != http.StatusOK {
-		log.Fatal(err)
+	defer resp.Body.Close()
+	// proxies in front of the server may answer with plain HTTP errors
+	err = wireformat.CheckResponse(resp)
+	if err != nil {
+		rpcFailed(err)
+	}
+	printMetadata("Response headers", resp.Header)
+
+	// decode straight off the body so the length prefix is checked against
+	// maxRecvMsgSize before anything is allocated; for unary calls keep a copy of what was read to print it
+	var bodyBytes bytes.Buffer
+	body := io.Reader(resp.Body)
+	if !md.IsStreamingServer() {
+		body = io.TeeReader(resp.Body, &bodyBytes)
 	}
-	bodyBytes, err := io.ReadAll(resp.Body)
+	// now unpack the wiremessage to get to the response
+	respMessage := wireformat.NewDecoder(body)
+	respMessage.SetMaxMessageSize(*maxRecvMsgSize)
+	fmt.Printf("server grpc-accept-encoding: %s\n", resp.Header.Get("grpc-accept-encoding"))
+	// frames with the compressed flag set use the encoding the server picked
+	err = respMessage.SetEncoding(resp.Header.Get("grpc-encoding"))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Printf("wire encoded EchoReply %s\n", hex.EncodeToString(bodyBytes))
+	if md.IsStreamingServer() {
+		// print each response as soon as its frame arrives; the trailers only follow the last one
+		err = respMessage.Receive(func(m []byte) error {
+			return printResponse(reg, md.Output(), m)
+		})
+		if err != nil {
+			rpcFailed(wireformat.ContextError(ctx, err))
+		}
+		printMetadata("Response trailers", resp.Trailer)
+		checkStatus(reg, resp)
+		return
+	}
+
+	respMessageBytes, err := respMessage.DecodeMessage()
+	if err != nil && err != io.EOF {
+		rpcFailed(wireformat.ContextError(ctx, err))
+	}
+	if err == nil {
+		// a unary response has exactly one message; reading to EOF also populates resp.Trailer
+		if _, err := respMessage.Decode(); err != io.EOF {
+			if err == nil {
+				err = status.Error(codes.Internal, "grpc: too many response messages for unary RPC")
+			}
+			rpcFailed(wireformat.ContextError(ctx, err))
+		}
+	}
 
-	bytesReader := bytes.NewReader(bodyBytes)
-	// now unpack the wiremessage to get to the unary response
-	respMessage := lencode.NewDecoder(bytesReader, lencode.SeparatorOpt([]byte{0}))
-	// note for streaming, you can just loop till EOF:
-	//  https://github.com/salrashid123/envoy_tap/blob/main/grpc/parser/main.go#L88-L104
-	respMessageBytes, err := respMessage.Decode()
+	printMetadata("Response trailers", resp.Trailer)
+	checkStatus(reg, resp)
+	if respMessageBytes == nil {
+		log.Fatal(status.Error(codes.Internal, "grpc: no response message for unary RPC"))
+	}
+
+	fmt.Printf("wire encoded response %s\n", hex.EncodeToString(bodyBytes.Bytes()))
+	fmt.Printf("Encoded response %s\n", hex.EncodeToString(respMessageBytes))
+	err = printResponse(reg, md.Output(), respMessageBytes)
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Printf("Encoded EchoReply %s\n", hex.EncodeToString(respMessageBytes))
+}
 
-	echoReplyMessageType, err := protoregistry.GlobalTypes.FindMessageByName("echo.EchoReply")
-	if err != nil {
-		panic(err)
+// parseRequests decodes a sequence of JSON objects into messages of type md.  No
+// JSON at all means a single empty message.
+func parseRequests(reg *protoset.Registry, md protoreflect.MessageDescriptor, data string) ([]proto.Message, error) {
+	var msgs []proto.Message
+	dec := json.NewDecoder(strings.NewReader(data))
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		m := dynamicpb.NewMessage(md)
+		err = protojson.UnmarshalOptions{Resolver: reg}.Unmarshal(raw, m)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	if len(msgs) == 0 {
+		msgs = append(msgs, dynamicpb.NewMessage(md))
 	}
-	echoReplyMessageDescriptor := echoReplyMessageType.Descriptor()
-	pmr := echoReplyMessageType.New()
+	return msgs, nil
+}
 
-	err = proto.Unmarshal(respMessageBytes, pmr.Interface())
+// printResponse decodes a serialized message of type md and prints it as JSON
+func printResponse(reg *protoset.Registry, md protoreflect.MessageDescriptor, b []byte) error {
+	m := dynamicpb.NewMessage(md)
+	err := proto.UnmarshalOptions{Resolver: reg}.Unmarshal(b, m)
+	if err != nil {
+		return err
+	}
+	s, err := protojson.MarshalOptions{Resolver: reg}.Marshal(m)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	msg := echoReplyMessageDescriptor.Fields().ByName("message")
+	fmt.Printf("Response: %s\n", string(s))
+	return nil
+}
 
-	fmt.Printf("EchoReply.Message using protoreflect: %s\n", pmr.Get(msg).String())
+// addHeaders sets --authority, grpc-accept-encoding and the -H metadata on req
+func addHeaders(req *http.Request) {
+	if *authority != "" {
+		req.Host = *authority
+	}
+	req.Header.Set("grpc-accept-encoding", wireformat.RegisteredCompressors())
+	for _, h := range headers {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 {
+			log.Fatalf("metadata %q is not in key:value form", h)
+		}
+		err := wireformat.AddMetadata(req.Header, strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// serviceName returns the package.Service part of a method name
+func serviceName(method string) string {
+	name := strings.Replace(strings.TrimPrefix(method, "/"), "/", ".", 1)
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return name
+	}
+	return name[:i]
+}
+
+// configureEncoder applies the send size limit and --compressor to enc
+func configureEncoder(enc *wireformat.Encoder) {
+	enc.SetMaxMessageSize(*maxSendMsgSize)
+	if *compressor != "" {
+		err := enc.SetEncoding(*compressor)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
 
-	s, err := protojson.Marshal(pmr.Interface())
+// printMetadata prints the custom metadata in response headers or trailers, decoding -bin values
+func printMetadata(title string, h http.Header) {
+	md, err := wireformat.DecodeMetadata(h)
 	if err != nil {
-		panic(err)
+		log.Printf("could not decode %s: %v", title, err)
+		return
+	}
+	if md.Len() == 0 {
+		return
+	}
+	keys := make([]string, 0, md.Len())
+	for k := range md {
+		keys = append(keys, k)
 	}
-	fmt.Printf("EchoReply as string JSON: %s\n", string(s))
+	sort.Strings(keys)
+	fmt.Printf("%s:\n", title)
+	for _, k := range keys {
+		for _, v := range md[k] {
+			fmt.Printf("  %s: %q\n", k, v)
+		}
+	}
+}
+
+// checkStatus exits if the grpc-status trailer reports an error.  The response body
+// must have been read to EOF first.
+func checkStatus(reg *protoset.Registry, resp *http.Response) {
+	// the RPC's outcome is in the grpc-status trailer, not the HTTP status
+	st := wireformat.Status(resp.Header, resp.Trailer)
+	if st.Code() == codes.OK {
+		return
+	}
+	// the Any details resolve against the loaded .pb files, then the google.rpc error
+	// details linked in above
+	if len(st.Proto().Details) > 0 {
+		d, err := protojson.MarshalOptions{Resolver: reg}.Marshal(st.Proto())
+		if err != nil {
+			log.Printf("could not convert error details to JSON: %v", err)
+		} else {
+			fmt.Printf("Error details: %s\n", string(d))
+		}
+	}
+	rpcFailed(st.Err())
+}
 
+// rpcFailed exits with the gRPC code of err
+func rpcFailed(err error) {
+	log.Fatalf("RPC failed with code %s: %v", status.Code(err), err)
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"main/protoset"
+	"main/rawproto"
+	"main/wireformat"
+)
+
+/*
+decodes captured gRPC messages without a schema, like protoc --decode_raw:
+
+	go run grpc_decode/grpc_decode.go --in resp.bin
+	go run grpc_decode/grpc_decode.go --hex 00000000140a1248656c6c6f2073616c2061206d616e646572
+
+or with --explain prints an annotated hex dump of every byte, using field names from --type:
+
+	go run grpc_decode/grpc_decode.go --explain --in frame.bin --type echo.EchoRequest
+*/
+
+var (
+	in        = flag.String("in", "", "file holding gRPC frames (eg frame.bin, resp.bin) or with --payload a serialized message; empty reads stdin")
+	hexInput  = flag.String("hex", "", "hex encoded input to use instead of --in")
+	payload   = flag.Bool("payload", false, "the input is a bare serialized message rather than length-prefixed gRPC frames")
+	encoding  = flag.String("encoding", "gzip", "grpc-encoding used for frames with the compressed flag set")
+	explain   = flag.Bool("explain", false, "print an annotated hex dump with the offset and meaning of every byte")
+	protosets = flag.String("protoset", "grpc_services/src/echo/echo.pb", "comma separated FileDescriptorSet (.pb) files for --type")
+	msgType   = flag.String("type", "", "full name of the message type (eg echo.EchoRequest) to take --explain field names from")
+)
+
+func main() {
+	flag.Parse()
+
+	b, err := readInput()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var md protoreflect.MessageDescriptor
+	if *msgType != "" {
+		md, err = findType(*msgType)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	ex := rawproto.NewExplainer(os.Stdout)
+
+	if *payload || !looksFramed(b) {
+		if *explain {
+			err = ex.Message(b, 0, 0, md)
+		} else {
+			err = decodeMessage(b)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	r := bytes.NewReader(b)
+	dec := wireformat.NewDecoder(r)
+	dec.SetMaxMessageSize(len(b))
+	for i := 1; ; i++ {
+		offset := len(b) - r.Len()
+		f, err := dec.Decode()
+		if err == io.EOF {
+			return
+		}
+		if err != nil && *explain {
+			ex.Line(offset, b[offset:], 0, "not a frame: %v", err)
+			return
+		}
+		if err != nil {
+			// whatever follows the last whole frame
+			fmt.Printf("trailing %d bytes at offset %d: %s (%v)\n", len(b)-offset, offset, hex.EncodeToString(b[offset:]), err)
+			return
+		}
+		if *explain {
+			err = explainFrame(ex, f, offset, md)
+			if err != nil {
+				log.Printf("frame %d: %v", i, err)
+			}
+			continue
+		}
+		msg := f.Payload
+		if f.Compressed {
+			fmt.Printf("frame %d at offset %d: compressed, %d bytes\n", i, offset, len(f.Payload))
+			msg, err = decompress(f)
+		} else {
+			fmt.Printf("frame %d at offset %d: uncompressed, %d bytes\n", i, offset, len(f.Payload))
+		}
+		if err == nil {
+			err = decodeMessage(msg)
+		}
+		if err != nil {
+			log.Printf("frame %d: %v", i, err)
+		}
+	}
+}
+
+// explainFrame annotates the prefix and message of a frame which starts at offset.
+// The message of a compressed frame is explained after decompressing it, with
+// offsets into the decompressed bytes.
+func explainFrame(ex *rawproto.Explainer, f *wireformat.Frame, offset int, md protoreflect.MessageDescriptor) error {
+	h := f.Header()
+	if f.Compressed {
+		ex.Line(offset, h[:1], 0, "compressed flag: 1 (compressed with %s)", *encoding)
+	} else {
+		ex.Line(offset, h[:1], 0, "compressed flag: 0 (uncompressed)")
+	}
+	ex.Line(offset+1, h[1:], 0, "message length: %d", len(f.Payload))
+	if !f.Compressed {
+		return ex.Message(f.Payload, offset+wireformat.HeaderLen, 1, md)
+	}
+	ex.Line(offset+wireformat.HeaderLen, f.Payload, 0, "compressed message")
+	msg, err := decompress(f)
+	if err != nil {
+		return err
+	}
+	ex.Line(0, nil, 0, "decompressed message, %d bytes:", len(msg))
+	return ex.Message(msg, 0, 1, md)
+}
+
+// findType loads --protoset and looks up a message type in it
+func findType(name string) (protoreflect.MessageDescriptor, error) {
+	reg := protoset.NewRegistry()
+	_, err := reg.Load(strings.Split(*protosets, ",")...)
+	if err != nil {
+		return nil, err
+	}
+	d, err := reg.Files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("message type %s not found in %s: %v", name, *protosets, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", name)
+	}
+	return md, nil
+}
+
+// decompress inflates the payload of a compressed frame using --encoding
+func decompress(f *wireformat.Frame) ([]byte, error) {
+	dec := wireformat.NewDecoder(bytes.NewReader(f.Bytes()))
+	err := dec.SetEncoding(*encoding)
+	if err != nil {
+		return nil, err
+	}
+	return dec.DecodeMessage()
+}
+
+// readInput returns the bytes from --hex, --in or stdin
+func readInput() ([]byte, error) {
+	if *hexInput != "" {
+		return hex.DecodeString(strings.Join(strings.Fields(*hexInput), ""))
+	}
+	if *in == "" || *in == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(*in)
+}
+
+// looksFramed is true if b starts with a valid Length-Prefixed-Message header
+// whose payload fits in b
+func looksFramed(b []byte) bool {
+	if len(b) < wireformat.HeaderLen || b[0] > 1 {
+		return false
+	}
+	f, err := wireformat.NewDecoder(bytes.NewReader(b)).Decode()
+	return err == nil && f != nil
+}
+
+// decodeMessage prints a serialized message in protoc --decode_raw form
+func decodeMessage(b []byte) error {
+	fields, err := rawproto.Parse(b)
+	if err != nil {
+		return err
+	}
+	return rawproto.Format(os.Stdout, fields)
+}
@@ -23,6 +23,9 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type EchoServerClient interface {
 	SayHello(ctx context.Context, in *EchoRequest, opts ...grpc.CallOption) (*EchoReply, error)
+	SayHelloStream(ctx context.Context, in *EchoRequest, opts ...grpc.CallOption) (EchoServer_SayHelloStreamClient, error)
+	SayHelloClientStream(ctx context.Context, opts ...grpc.CallOption) (EchoServer_SayHelloClientStreamClient, error)
+	SayHelloBidiStream(ctx context.Context, opts ...grpc.CallOption) (EchoServer_SayHelloBidiStreamClient, error)
 }
 
 type echoServerClient struct {
@@ -42,11 +45,111 @@ func (c *echoServerClient) SayHello(ctx context.Context, in *EchoRequest, opts .
 	return out, nil
 }
 
+func (c *echoServerClient) SayHelloStream(ctx context.Context, in *EchoRequest, opts ...grpc.CallOption) (EchoServer_SayHelloStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EchoServer_ServiceDesc.Streams[0], "/echo.EchoServer/SayHelloStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &echoServerSayHelloStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type EchoServer_SayHelloStreamClient interface {
+	Recv() (*EchoReply, error)
+	grpc.ClientStream
+}
+
+type echoServerSayHelloStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *echoServerSayHelloStreamClient) Recv() (*EchoReply, error) {
+	m := new(EchoReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *echoServerClient) SayHelloClientStream(ctx context.Context, opts ...grpc.CallOption) (EchoServer_SayHelloClientStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EchoServer_ServiceDesc.Streams[1], "/echo.EchoServer/SayHelloClientStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &echoServerSayHelloClientStreamClient{stream}
+	return x, nil
+}
+
+type EchoServer_SayHelloClientStreamClient interface {
+	Send(*EchoRequest) error
+	CloseAndRecv() (*EchoReply, error)
+	grpc.ClientStream
+}
+
+type echoServerSayHelloClientStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *echoServerSayHelloClientStreamClient) Send(m *EchoRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *echoServerSayHelloClientStreamClient) CloseAndRecv() (*EchoReply, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(EchoReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *echoServerClient) SayHelloBidiStream(ctx context.Context, opts ...grpc.CallOption) (EchoServer_SayHelloBidiStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EchoServer_ServiceDesc.Streams[2], "/echo.EchoServer/SayHelloBidiStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &echoServerSayHelloBidiStreamClient{stream}
+	return x, nil
+}
+
+type EchoServer_SayHelloBidiStreamClient interface {
+	Send(*EchoRequest) error
+	Recv() (*EchoReply, error)
+	grpc.ClientStream
+}
+
+type echoServerSayHelloBidiStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *echoServerSayHelloBidiStreamClient) Send(m *EchoRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *echoServerSayHelloBidiStreamClient) Recv() (*EchoReply, error) {
+	m := new(EchoReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // EchoServerServer is the server API for EchoServer service.
 // All implementations must embed UnimplementedEchoServerServer
 // for forward compatibility
 type EchoServerServer interface {
 	SayHello(context.Context, *EchoRequest) (*EchoReply, error)
+	SayHelloStream(*EchoRequest, EchoServer_SayHelloStreamServer) error
+	SayHelloClientStream(EchoServer_SayHelloClientStreamServer) error
+	SayHelloBidiStream(EchoServer_SayHelloBidiStreamServer) error
 	mustEmbedUnimplementedEchoServerServer()
 }
 
@@ -57,6 +160,15 @@ type UnimplementedEchoServerServer struct {
 func (UnimplementedEchoServerServer) SayHello(context.Context, *EchoRequest) (*EchoReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SayHello not implemented")
 }
+func (UnimplementedEchoServerServer) SayHelloStream(*EchoRequest, EchoServer_SayHelloStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method SayHelloStream not implemented")
+}
+func (UnimplementedEchoServerServer) SayHelloClientStream(EchoServer_SayHelloClientStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method SayHelloClientStream not implemented")
+}
+func (UnimplementedEchoServerServer) SayHelloBidiStream(EchoServer_SayHelloBidiStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method SayHelloBidiStream not implemented")
+}
 func (UnimplementedEchoServerServer) mustEmbedUnimplementedEchoServerServer() {}
 
 // UnsafeEchoServerServer may be embedded to opt out of forward compatibility for this service.
@@ -88,6 +200,79 @@ func _EchoServer_SayHello_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _EchoServer_SayHelloStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EchoRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EchoServerServer).SayHelloStream(m, &echoServerSayHelloStreamServer{stream})
+}
+
+type EchoServer_SayHelloStreamServer interface {
+	Send(*EchoReply) error
+	grpc.ServerStream
+}
+
+type echoServerSayHelloStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *echoServerSayHelloStreamServer) Send(m *EchoReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _EchoServer_SayHelloClientStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EchoServerServer).SayHelloClientStream(&echoServerSayHelloClientStreamServer{stream})
+}
+
+type EchoServer_SayHelloClientStreamServer interface {
+	SendAndClose(*EchoReply) error
+	Recv() (*EchoRequest, error)
+	grpc.ServerStream
+}
+
+type echoServerSayHelloClientStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *echoServerSayHelloClientStreamServer) SendAndClose(m *EchoReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *echoServerSayHelloClientStreamServer) Recv() (*EchoRequest, error) {
+	m := new(EchoRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _EchoServer_SayHelloBidiStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EchoServerServer).SayHelloBidiStream(&echoServerSayHelloBidiStreamServer{stream})
+}
+
+type EchoServer_SayHelloBidiStreamServer interface {
+	Send(*EchoReply) error
+	Recv() (*EchoRequest, error)
+	grpc.ServerStream
+}
+
+type echoServerSayHelloBidiStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *echoServerSayHelloBidiStreamServer) Send(m *EchoReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *echoServerSayHelloBidiStreamServer) Recv() (*EchoRequest, error) {
+	m := new(EchoRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // EchoServer_ServiceDesc is the grpc.ServiceDesc for EchoServer service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -100,6 +285,23 @@ var EchoServer_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _EchoServer_SayHello_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SayHelloStream",
+			Handler:       _EchoServer_SayHelloStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SayHelloClientStream",
+			Handler:       _EchoServer_SayHelloClientStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "SayHelloBidiStream",
+			Handler:       _EchoServer_SayHelloBidiStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "src/echo/echo.proto",
 }
@@ -25,6 +25,8 @@ var (
 	address         = flag.String("host", "localhost:50051", "host:port of gRPC server")
 	cacert          = flag.String("cacert", "certs/tls-ca-chain.pem", "CACert for server")
 	serverName      = flag.String("servername", "localhost", "SNI for server")
+	clientCert      = flag.String("cert", "", "client certificate for mTLS")
+	clientKey       = flag.String("key", "", "client key for mTLS")
 	skipHealthCheck = flag.Bool("skipHealthCheck", false, "Skip Initial Healthcheck")
 )
 
@@ -45,6 +47,13 @@ func main() {
 		ServerName: *serverName,
 		RootCAs:    caCertPool,
 	}
+	if *clientCert != "" || *clientKey != "" {
+		certificate, err := tls.LoadX509KeyPair(*clientCert, *clientKey)
+		if err != nil {
+			log.Fatalf("could not load client key pair: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
 
 	creds := credentials.NewTLS(&tlsConfig)
 
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"compress/flate"
 	"crypto/tls"
+	"crypto/x509"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	echo "github.com/salrashid123/grpc_wireformat/grpc_services/src/echo"
 
@@ -13,9 +20,18 @@ import (
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/types/known/durationpb"
+
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
@@ -23,14 +39,25 @@ import (
 
 var (
 	insecure = flag.Bool("insecure", false, "start without tls")
-	grpcport = flag.String("grpcport", ":50051", "grpcport")
+	grpcport = flag.String("grpcport", ":50051", "grpcport (host:port or unix:///path.sock)")
 	tlsCert  = flag.String("tlsCert", "certs/localhost.crt", "TLS Cert")
 	tlsKey   = flag.String("tlsKey", "certs/localhost.key", "TLS Key")
 	tlsCA    = flag.String("tlsCA", "certs/tls-ca-chain.pem", "TLS CA")
+
+	clientCA          = flag.String("clientCA", "certs/tls-ca-chain.pem", "CA used to verify client certificates")
+	requireClientCert = flag.Bool("requireClientCert", false, "reject clients that don't present a certificate signed by clientCA")
+
+	delay        = flag.Duration("delay", 0, "artificial delay before SayHello replies, to test client deadlines")
+	errorDetails = flag.Bool("errorDetails", false, "fail SayHello with BadRequest, RetryInfo and ErrorInfo error details")
+	compressors  = flag.String("compressors", "gzip", "comma separated grpc-encodings to register and advertise (gzip,deflate,snappy,zstd); gzip is always registered")
 )
 
 const (
 	address string = ":50051"
+
+	// SayHelloStream sends this many replies, one every streamInterval
+	streamReplies  = 5
+	streamInterval = 500 * time.Millisecond
 )
 
 type Server struct {
@@ -48,6 +75,90 @@ func NewServer() *Server {
 	}
 }
 
+// deflateCompressor, snappyCompressor and zstdCompressor are copies of the ones in
+// wireformat/compress.go: grpc_services is a module of its own and can't import
+// that package, so keep the two in step when changing either
+type deflateCompressor struct{}
+
+func (deflateCompressor) Name() string {
+	return "deflate"
+}
+
+func (deflateCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, flate.DefaultCompression)
+}
+
+func (deflateCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return flate.NewReader(r), nil
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Name() string {
+	return "snappy"
+}
+
+func (snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return snappy.NewReader(r), nil
+}
+
+type zstdCompressor struct{}
+
+func (zstdCompressor) Name() string {
+	return "zstd"
+}
+
+func (zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+func (zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// grpc-go v1.43 only ships gzip (its pooled compressor, registered by the import
+// above); the others are written out here the same way wireformat does them
+var availableCompressors = map[string]encoding.Compressor{
+	"gzip":    encoding.GetCompressor("gzip"),
+	"deflate": deflateCompressor{},
+	"snappy":  snappyCompressor{},
+	"zstd":    zstdCompressor{},
+}
+
+// advertiseCompressors sends the registered encodings back in grpc-accept-encoding
+func advertiseCompressors(names []string) grpc.UnaryServerInterceptor {
+	accept := acceptEncoding(names)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := grpc.SetHeader(ctx, metadata.Pairs("grpc-accept-encoding", accept)); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// advertiseCompressorsStream is advertiseCompressors for streaming methods
+func advertiseCompressorsStream(names []string) grpc.StreamServerInterceptor {
+	accept := acceptEncoding(names)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := ss.SetHeader(metadata.Pairs("grpc-accept-encoding", accept)); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func acceptEncoding(names []string) string {
+	return strings.Join(append([]string{"identity"}, names...), ",")
+}
+
 func (s *Server) SayHello(ctx context.Context, in *echo.EchoRequest) (*echo.EchoReply, error) {
 	mname := ""
 	m := in.MiddleName
@@ -55,9 +166,114 @@ func (s *Server) SayHello(ctx context.Context, in *echo.EchoRequest) (*echo.Echo
 		mname = m.Name
 	}
 	log.Printf("Got rpc: --> %s %s %s \n", in.FirstName, mname, in.LastName)
+	if deadline, ok := ctx.Deadline(); ok {
+		log.Printf("     deadline in %v\n", time.Until(deadline))
+	}
+	// echo x- prefixed metadata back as response headers
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		echoed := metadata.MD{}
+		for k, v := range md {
+			if strings.HasPrefix(k, "x-") {
+				log.Printf("     metadata %s: %q\n", k, v)
+				echoed[k] = v
+			}
+		}
+		if err := grpc.SetHeader(ctx, echoed); err != nil {
+			return nil, err
+		}
+	}
+	if *delay > 0 {
+		select {
+		case <-time.After(*delay):
+		case <-ctx.Done():
+			log.Printf("     gave up after %v\n", ctx.Err())
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+			log.Printf("     authenticated client: %s\n", tlsInfo.State.VerifiedChains[0][0].Subject)
+		}
+	}
+	if *errorDetails {
+		st, err := status.New(codes.InvalidArgument, "middle name not accepted").WithDetails(
+			&errdetails.BadRequest{
+				FieldViolations: []*errdetails.BadRequest_FieldViolation{
+					{Field: "middle_name.name", Description: "middle names are not supported"},
+				},
+			},
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(5 * time.Second)},
+			&errdetails.ErrorInfo{Reason: "MIDDLE_NAME_REJECTED", Domain: "echo.EchoServer", Metadata: map[string]string{"first_name": in.FirstName}},
+		)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not attach error details: %v", err)
+		}
+		return nil, st.Err()
+	}
 	return &echo.EchoReply{Message: "Hello " + in.FirstName + " " + mname + " " + in.LastName}, nil
 }
 
+func (s *Server) SayHelloStream(in *echo.EchoRequest, stream echo.EchoServer_SayHelloStreamServer) error {
+	mname := ""
+	m := in.MiddleName
+	if m != nil {
+		mname = m.Name
+	}
+	log.Printf("Got stream rpc: --> %s %s %s \n", in.FirstName, mname, in.LastName)
+	for i := 1; i <= streamReplies; i++ {
+		err := stream.Send(&echo.EchoReply{Message: fmt.Sprintf("Hello %s %s %s (%d/%d)", in.FirstName, mname, in.LastName, i, streamReplies)})
+		if err != nil {
+			return err
+		}
+		time.Sleep(streamInterval)
+	}
+	return nil
+}
+
+func (s *Server) SayHelloClientStream(stream echo.EchoServer_SayHelloClientStreamServer) error {
+	var names []string
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			// the client half-closed; only now is the single reply sent
+			log.Printf("Got client stream half-close after %d messages\n", len(names))
+			return stream.SendAndClose(&echo.EchoReply{Message: fmt.Sprintf("Hello %s (%d messages)", strings.Join(names, ", "), len(names))})
+		}
+		if err != nil {
+			return err
+		}
+		mname := ""
+		if in.MiddleName != nil {
+			mname = in.MiddleName.Name
+		}
+		log.Printf("Got client stream rpc: --> %s %s %s \n", in.FirstName, mname, in.LastName)
+		names = append(names, in.FirstName+" "+mname+" "+in.LastName)
+	}
+}
+
+func (s *Server) SayHelloBidiStream(stream echo.EchoServer_SayHelloBidiStreamServer) error {
+	for i := 1; ; i++ {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			log.Printf("Got bidi stream half-close after %d messages\n", i-1)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		mname := ""
+		if in.MiddleName != nil {
+			mname = in.MiddleName.Name
+		}
+		log.Printf("Got bidi stream rpc: --> %s %s %s \n", in.FirstName, mname, in.LastName)
+		// reply to each message as it arrives so the client sees them interleaved
+		err = stream.Send(&echo.EchoReply{Message: fmt.Sprintf("Hello %s %s %s (%d)", in.FirstName, mname, in.LastName, i)})
+		if err != nil {
+			return err
+		}
+	}
+}
+
 func (s *Server) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -90,8 +306,32 @@ func main() {
 		os.Exit(2)
 	}
 
-	sopts := []grpc.ServerOption{grpc.MaxConcurrentStreams(10)}
-	lis, err := net.Listen("tcp", *grpcport)
+	// importing grpc-go's gzip registers it whatever the flag says, so it is
+	// always advertised too
+	registered := []string{"gzip"}
+	for _, name := range strings.Split(*compressors, ",") {
+		if name == "" || name == "gzip" {
+			continue
+		}
+		c, ok := availableCompressors[name]
+		if !ok {
+			log.Fatalf("unknown compressor %q", name)
+		}
+		encoding.RegisterCompressor(c)
+		registered = append(registered, name)
+	}
+	log.Printf("Registered compressors %v", registered)
+
+	sopts := []grpc.ServerOption{grpc.MaxConcurrentStreams(10), grpc.UnaryInterceptor(advertiseCompressors(registered)), grpc.StreamInterceptor(advertiseCompressorsStream(registered))}
+	// --grpcport unix:///path/to/grpc.sock listens on a unix domain socket
+	network, laddr := "tcp", *grpcport
+	if strings.HasPrefix(*grpcport, "unix://") {
+		network, laddr = "unix", strings.TrimPrefix(*grpcport, "unix://")
+		if err := os.Remove(laddr); err != nil && !os.IsNotExist(err) {
+			log.Fatalf("could not remove stale socket: %v", err)
+		}
+	}
+	lis, err := net.Listen(network, laddr)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
@@ -101,8 +341,23 @@ func main() {
 			log.Fatalf("could not load server key pair: %s", err)
 		}
 
+		clientCACert, err := ioutil.ReadFile(*clientCA)
+		if err != nil {
+			log.Fatalf("could not load client CA: %s", err)
+		}
+		clientCAPool := x509.NewCertPool()
+		clientCAPool.AppendCertsFromPEM(clientCACert)
+
+		// client certificates are always verified if presented
+		clientAuth := tls.VerifyClientCertIfGiven
+		if *requireClientCert {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+
 		tlsConfig := tls.Config{
 			Certificates: []tls.Certificate{certificate},
+			ClientCAs:    clientCAPool,
+			ClientAuth:   clientAuth,
 		}
 		creds := credentials.NewTLS(&tlsConfig)
 
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"main/grpctrace"
+	"main/protoset"
+)
+
+/*
+decodes the gRPC calls recorded by the Envoy TAP filter:
+
+	go run grpc_tap/grpc_tap.go --tap /tmp/tap_123.json
+
+takes the JSON (use JSON_BODY_AS_BYTES), PROTO_BINARY and PROTO_BINARY_LENGTH_DELIMITED
+formats, for buffered and streamed traces.  Messages of methods found in --protoset are
+printed as JSON, anything else as protoc --decode_raw would.
+*/
+
+var (
+	taps      = flag.String("tap", "", "comma separated files written by the Envoy TAP filter's file_per_tap sink")
+	protosets = flag.String("protoset", "grpc_services/src/echo/echo.pb", "comma separated FileDescriptorSet (.pb) files describing the tapped services")
+)
+
+func main() {
+	flag.Parse()
+	if *taps == "" {
+		log.Fatal("--tap is required")
+	}
+
+	reg := protoset.NewRegistry()
+	_, err := reg.Load(strings.Split(*protosets, ",")...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := grpctrace.NewPrinter(os.Stdout, reg)
+	for _, name := range strings.Split(*taps, ",") {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rpcs, err := grpctrace.ReadTap(name, f)
+		f.Close()
+		if err != nil {
+			log.Printf("skipping: %v", err)
+			continue
+		}
+		for _, rpc := range rpcs {
+			err = p.Print(rpc)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"main/grpctrace"
+	"main/protoset"
+)
+
+/*
+decodes the gRPC calls in a packet capture without Wireshark:
+
+	go run grpc_trace/grpc_trace.go --pcap trace.cap
+
+TLS connections are decrypted with the key log the client wrote (grpc_client_dynamic.go --keylog,
+or $SSLKEYLOGFILE for other clients):
+
+	go run grpc_trace/grpc_trace.go --pcap tls.cap --keylog keys.log
+
+Messages of methods found in --protoset are printed as JSON, anything else as protoc --decode_raw would.
+*/
+
+var (
+	pcap      = flag.String("pcap", "trace.cap", "pcap or pcapng capture file")
+	protosets = flag.String("protoset", "grpc_services/src/echo/echo.pb", "comma separated FileDescriptorSet (.pb) files describing the captured services")
+	keyLog    = flag.String("keylog", "", "NSS key log file (SSLKEYLOGFILE) with the secrets of TLS connections in the capture")
+)
+
+func main() {
+	flag.Parse()
+
+	reg := protoset.NewRegistry()
+	_, err := reg.Load(strings.Split(*protosets, ",")...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var keys *grpctrace.KeyLog
+	if *keyLog != "" {
+		f, err := os.Open(*keyLog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		keys, err = grpctrace.ReadKeyLog(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(*pcap)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	conns, err := grpctrace.ReadPcap(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := grpctrace.NewPrinter(os.Stdout, reg)
+	for _, c := range conns {
+		if len(c.ClientData) == 0 && len(c.ServerData) == 0 {
+			continue
+		}
+		name := c.Client + " -> " + c.Server
+		client, server := c.ClientData, c.ServerData
+		if grpctrace.IsTLS(client) {
+			if keys == nil {
+				log.Printf("skipping connection: %s: TLS, decrypting needs --keylog", name)
+				continue
+			}
+			client, server, err = grpctrace.DecryptTLS(client, server, keys)
+			if err != nil && len(client) == 0 {
+				log.Printf("skipping connection: %s: %v", name, err)
+				continue
+			}
+			if err != nil {
+				// keep what was decrypted before the bad record
+				log.Printf("%s: %v", name, err)
+			}
+		}
+		rpcs, err := grpctrace.ParseHTTP2(name, client, server)
+		if err != nil {
+			log.Printf("skipping connection: %v", err)
+			continue
+		}
+		for _, rpc := range rpcs {
+			if rpc.Path == "" {
+				// control frames on stream 0, or a stream whose HEADERS weren't captured
+				continue
+			}
+			err = p.Print(rpc)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package grpctrace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// pcap and pcapng are read here rather than with gopacket/pcapgo since that
+// truncates link types to a byte, which loses LINKTYPE_LINUX_SLL2 (276)
+
+const (
+	pcapMagic      = 0xa1b2c3d4
+	pcapMagicNanos = 0xa1b23c4d
+	pcapHeaderLen  = 24
+	pcapRecordLen  = 16
+
+	pcapngSectionHeader    = 0x0a0d0d0a
+	pcapngInterface        = 1
+	pcapngSimplePacket     = 3
+	pcapngEnhancedPacket   = 6
+	pcapngByteOrderMagic   = 0x1a2b3c4d
+	pcapngMaxBlockLen      = 64 << 20
+	pcapngBlockOverhead    = 12
+	pcapngSectionHeaderLen = 16
+)
+
+// errNotCapture is returned for files that are neither pcap nor pcapng
+var errNotCapture = errors.New("grpctrace: not a pcap or pcapng file")
+
+// captureReader returns the packets of a pcap or pcapng file with the link type
+// of each
+type captureReader interface {
+	next() (linkType uint32, data []byte, err error)
+}
+
+// newCaptureReader detects the file format from its magic number
+func newCaptureReader(r io.Reader) (captureReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, errNotCapture
+	}
+	if binary.LittleEndian.Uint32(magic) == pcapngSectionHeader {
+		return &pcapngReader{r: br}, nil
+	}
+	var hdr [pcapHeaderLen]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, errNotCapture
+	}
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint32(hdr[:]) == pcapMagic || binary.LittleEndian.Uint32(hdr[:]) == pcapMagicNanos:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[:]) == pcapMagic || binary.BigEndian.Uint32(hdr[:]) == pcapMagicNanos:
+		order = binary.BigEndian
+	default:
+		return nil, errNotCapture
+	}
+	// the top bits of the link type field can hold the FCS length
+	return &pcapReader{r: br, order: order, linkType: order.Uint32(hdr[20:]) & 0x0fffffff}, nil
+}
+
+type pcapReader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	linkType uint32
+}
+
+func (p *pcapReader) next() (uint32, []byte, error) {
+	var hdr [pcapRecordLen]byte
+	if _, err := io.ReadFull(p.r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := p.order.Uint32(hdr[8:])
+	if n > pcapngMaxBlockLen {
+		return 0, nil, fmt.Errorf("grpctrace: pcap record of %d bytes", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	return p.linkType, data, nil
+}
+
+type pcapngReader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	// linkTypes of the interfaces in the current section, by interface id
+	linkTypes []uint32
+}
+
+func (p *pcapngReader) next() (uint32, []byte, error) {
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(p.r, hdr[:]); err != nil {
+			return 0, nil, err
+		}
+		typ := binary.LittleEndian.Uint32(hdr[:])
+		if typ == pcapngSectionHeader {
+			// each section says its own byte order
+			var bom [4]byte
+			if _, err := io.ReadFull(p.r, bom[:]); err != nil {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			switch {
+			case binary.LittleEndian.Uint32(bom[:]) == pcapngByteOrderMagic:
+				p.order = binary.LittleEndian
+			case binary.BigEndian.Uint32(bom[:]) == pcapngByteOrderMagic:
+				p.order = binary.BigEndian
+			default:
+				return 0, nil, errNotCapture
+			}
+			p.linkTypes = nil
+			n := p.order.Uint32(hdr[4:])
+			if n < pcapngSectionHeaderLen || n > pcapngMaxBlockLen {
+				return 0, nil, fmt.Errorf("grpctrace: pcapng section header of %d bytes", n)
+			}
+			if _, err := io.CopyN(io.Discard, p.r, int64(n)-12); err != nil {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			continue
+		}
+		if p.order == nil {
+			return 0, nil, errNotCapture
+		}
+		typ = p.order.Uint32(hdr[:])
+		n := p.order.Uint32(hdr[4:])
+		if n < pcapngBlockOverhead || n > pcapngMaxBlockLen {
+			return 0, nil, fmt.Errorf("grpctrace: pcapng block of %d bytes", n)
+		}
+		body := make([]byte, n-8)
+		if _, err := io.ReadFull(p.r, body); err != nil {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		body = body[:len(body)-4]
+
+		switch typ {
+		case pcapngInterface:
+			if len(body) < 2 {
+				return 0, nil, fmt.Errorf("grpctrace: short pcapng interface block")
+			}
+			p.linkTypes = append(p.linkTypes, uint32(p.order.Uint16(body)))
+		case pcapngEnhancedPacket:
+			if len(body) < 20 {
+				return 0, nil, fmt.Errorf("grpctrace: short pcapng packet block")
+			}
+			id := p.order.Uint32(body)
+			capLen := p.order.Uint32(body[12:])
+			if int(id) >= len(p.linkTypes) || int(capLen) > len(body)-20 {
+				return 0, nil, fmt.Errorf("grpctrace: malformed pcapng packet block")
+			}
+			return p.linkTypes[id], body[20 : 20+capLen], nil
+		case pcapngSimplePacket:
+			if len(p.linkTypes) == 0 || len(body) < 4 {
+				return 0, nil, fmt.Errorf("grpctrace: malformed pcapng simple packet block")
+			}
+			// the captured length is whatever fits in the block, up to the original length
+			data := body[4:]
+			if orig := p.order.Uint32(body); int(orig) < len(data) {
+				data = data[:orig]
+			}
+			return p.linkTypes[0], data, nil
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package grpctrace
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"main/wireformat"
+)
+
+// LogFrames returns a connection that writes every HTTP/2 frame sent (->) or
+// received (<-) on c to w, with the time and stream.  Header blocks are shown
+// HPACK decoded and DATA frames with where each gRPC message starts and ends.
+// c is the client side, after any TLS, so the first thing written is the
+// connection preface.
+//
+// The frames are parsed and written in the background from copies of the data,
+// so a slow w doesn't hold up the connection.  If the logging falls more than
+// feedQueue reads or writes behind it stops for that direction rather than wait.
+func LogFrames(c net.Conn, w io.Writer) net.Conn {
+	fl := &frameLog{w: w}
+	return &loggedConn{Conn: c, sent: fl.start("->", true), received: fl.start("<-", false)}
+}
+
+// feedQueue is how many reads or writes the frame parser of each direction can
+// be behind the connection
+const feedQueue = 1024
+
+// errFellBehind ends the logging of a direction whose parser didn't keep up
+var errFellBehind = errors.New("frame logging fell behind the connection and stopped")
+
+// loggedConn copies what goes through the connection to a frame parser for each
+// direction
+type loggedConn struct {
+	net.Conn
+	sent, received *feed
+}
+
+func (c *loggedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.received.write(b[:n])
+	}
+	if err != nil {
+		c.received.close(err)
+	}
+	return n, err
+}
+
+func (c *loggedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.sent.write(b[:n])
+	}
+	return n, err
+}
+
+func (c *loggedConn) Close() error {
+	c.sent.close(io.EOF)
+	c.received.close(io.EOF)
+	return c.Conn.Close()
+}
+
+// feed passes copies of the data going one way through the connection to its
+// frame parser without waiting for it.  It is the io.Reader the parser reads.
+type feed struct {
+	mu     sync.Mutex
+	ch     chan []byte
+	closed bool
+	// err is what the parser gets once ch is drained, set before ch is closed
+	err error
+	// buf is the rest of the chunk the parser is reading
+	buf []byte
+}
+
+func (f *feed) write(b []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	select {
+	case f.ch <- append([]byte(nil), b...):
+	default:
+		// skipping the chunk would leave the parser reading garbage, so stop
+		f.closeLocked(errFellBehind)
+	}
+}
+
+func (f *feed) close(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closeLocked(err)
+	}
+}
+
+func (f *feed) closeLocked(err error) {
+	f.closed = true
+	f.err = err
+	close(f.ch)
+}
+
+func (f *feed) Read(b []byte) (int, error) {
+	if len(f.buf) == 0 {
+		chunk, ok := <-f.ch
+		if !ok {
+			return 0, f.err
+		}
+		f.buf = chunk
+	}
+	n := copy(b, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// frameLog writes the frames of both directions of a connection
+type frameLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// start parses the frames written to the returned feed in a goroutine.  If they
+// stop parsing the feed is closed so nothing more is copied.
+func (fl *frameLog) start(dir string, preface bool) *feed {
+	f := &feed{ch: make(chan []byte, feedQueue)}
+	go func() {
+		defer f.close(io.EOF)
+		if preface {
+			p := make([]byte, len(clientPreface))
+			if _, err := io.ReadFull(f, p); err != nil {
+				return
+			}
+			fl.printf(dir, "connection preface %q", p)
+		}
+		fr := newFramer(f)
+		// what is left of the gRPC message being read on each stream
+		streams := map[uint32]*dataState{}
+		for {
+			frame, err := fr.ReadFrame()
+			var se http2.StreamError
+			if errors.As(err, &se) {
+				fl.printf(dir, "stream %d: %v", se.StreamID, err)
+				continue
+			}
+			if err != nil {
+				if err != io.EOF {
+					fl.printf(dir, "%v", err)
+				}
+				return
+			}
+			fl.frame(dir, frame, streams)
+		}
+	}()
+	return f
+}
+
+func (fl *frameLog) printf(dir string, format string, args ...interface{}) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fmt.Fprintf(fl.w, "%s %s %s\n", time.Now().Format("15:04:05.000000"), dir, fmt.Sprintf(format, args...))
+}
+
+func (fl *frameLog) frame(dir string, f http2.Frame, streams map[uint32]*dataState) {
+	h := f.Header()
+	head := fmt.Sprintf("%s stream=%d len=%d%s", h.Type, h.StreamID, h.Length, flagNames(h))
+	var lines []string
+	switch f := f.(type) {
+	case *http2.MetaHeadersFrame:
+		for _, hf := range f.Fields {
+			lines = append(lines, hf.Name+": "+hf.Value)
+		}
+	case *http2.DataFrame:
+		ds := streams[f.StreamID]
+		if ds == nil {
+			ds = &dataState{}
+			streams[f.StreamID] = ds
+		}
+		lines = ds.read(f.Data())
+		if f.StreamEnded() {
+			delete(streams, f.StreamID)
+		}
+	case *http2.SettingsFrame:
+		f.ForeachSetting(func(s http2.Setting) error {
+			lines = append(lines, fmt.Sprintf("%v: %d", s.ID, s.Val))
+			return nil
+		})
+	case *http2.WindowUpdateFrame:
+		head += fmt.Sprintf(" increment=%d", f.Increment)
+	case *http2.RSTStreamFrame:
+		head += fmt.Sprintf(" error=%v", f.ErrCode)
+	case *http2.GoAwayFrame:
+		head += fmt.Sprintf(" last_stream=%d error=%v", f.LastStreamID, f.ErrCode)
+		if len(f.DebugData()) > 0 {
+			head += fmt.Sprintf(" debug=%q", f.DebugData())
+		}
+	case *http2.PingFrame:
+		head += " data=" + hex.EncodeToString(f.Data[:])
+	}
+
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fmt.Fprintf(fl.w, "%s %s %s\n", time.Now().Format("15:04:05.000000"), dir, head)
+	for _, l := range lines {
+		fmt.Fprintf(fl.w, "    %s\n", l)
+	}
+}
+
+// flagNames lists the flags set on a frame, eg " END_STREAM|END_HEADERS"
+func flagNames(h http2.FrameHeader) string {
+	var names []string
+	switch h.Type {
+	case http2.FrameData:
+		if h.Flags.Has(http2.FlagDataEndStream) {
+			names = append(names, "END_STREAM")
+		}
+	case http2.FrameHeaders:
+		if h.Flags.Has(http2.FlagHeadersEndStream) {
+			names = append(names, "END_STREAM")
+		}
+		if h.Flags.Has(http2.FlagHeadersEndHeaders) {
+			names = append(names, "END_HEADERS")
+		}
+	case http2.FrameSettings, http2.FramePing:
+		if h.Flags.Has(http2.FlagSettingsAck) {
+			names = append(names, "ACK")
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return " " + strings.Join(names, "|")
+}
+
+// dataState follows the Length-Prefixed-Messages across the DATA frames of a
+// stream
+type dataState struct {
+	n int
+	// header holds the part of a message header read so far
+	header []byte
+	// compressed and size are from the header of the message being read, and
+	// left is how much of it is still to come
+	compressed bool
+	size, left int
+}
+
+// read describes where the messages in one DATA frame's payload start and end
+func (ds *dataState) read(b []byte) []string {
+	var lines []string
+	off := 0
+	for off < len(b) {
+		if ds.left == 0 && len(ds.header) < wireformat.HeaderLen {
+			n := wireformat.HeaderLen - len(ds.header)
+			if n > len(b)-off {
+				n = len(b) - off
+			}
+			ds.header = append(ds.header, b[off:off+n]...)
+			off += n
+			if len(ds.header) < wireformat.HeaderLen {
+				lines = append(lines, fmt.Sprintf("grpc message %d: header, %d of %d bytes", ds.n+1, len(ds.header), wireformat.HeaderLen))
+				break
+			}
+			ds.n++
+			ds.compressed = ds.header[0] == 1
+			ds.size = int(binary.BigEndian.Uint32(ds.header[1:]))
+			ds.left = ds.size
+			if ds.size == 0 {
+				lines = append(lines, fmt.Sprintf("grpc message %d: %s, empty", ds.n, ds.kind()))
+				ds.header = ds.header[:0]
+			}
+			continue
+		}
+		n := ds.left
+		if n > len(b)-off {
+			n = len(b) - off
+		}
+		from := ds.size - ds.left
+		ds.left -= n
+		off += n
+		line := fmt.Sprintf("grpc message %d: %s, bytes %d-%d of %d", ds.n, ds.kind(), from, from+n, ds.size)
+		if ds.left == 0 {
+			ds.header = ds.header[:0]
+		} else {
+			line += ", continues in the next frame"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (ds *dataState) kind() string {
+	if ds.compressed {
+		return "compressed"
+	}
+	return "uncompressed"
+}
@@ -0,0 +1,116 @@
+package grpctrace
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// logBuffer is a bytes.Buffer the frame log can write to while the test reads it
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	// block, if not nil, holds up every write until it is closed
+	block chan struct{}
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	if b.block != nil {
+		<-b.block
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// waitFor returns the log once it contains all of want, or fails the test
+func (b *logBuffer) waitFor(t *testing.T, want ...string) string {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		b.mu.Lock()
+		out := b.buf.String()
+		b.mu.Unlock()
+		missing := ""
+		for _, w := range want {
+			if !strings.Contains(out, w) {
+				missing = w
+				break
+			}
+		}
+		if missing == "" {
+			return out
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the frame log has no %q:\n%s", missing, out)
+		}
+	}
+}
+
+// pipe returns the client end of a connection whose server end discards
+// everything
+func pipe(t *testing.T) net.Conn {
+	client, server := net.Pipe()
+	go io.Copy(ioutil.Discard, server)
+	t.Cleanup(func() { server.Close() })
+	return client
+}
+
+func TestLogFrames(t *testing.T) {
+	out := &logBuffer{}
+	c := LogFrames(pipe(t), out)
+	defer c.Close()
+
+	io.WriteString(c, http2.ClientPreface)
+	fr := http2.NewFramer(c, nil)
+	fr.WriteSettings(http2.Setting{ID: http2.SettingInitialWindowSize, Val: 1 << 20})
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/echo.EchoServer/SayHello"})
+	fr.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: block.Bytes(), EndHeaders: true})
+	// the message is split over two DATA frames
+	fr.WriteData(1, false, requestFrame[:10])
+	fr.WriteData(1, true, requestFrame[10:])
+
+	out.waitFor(t,
+		"-> connection preface",
+		"-> SETTINGS stream=0",
+		"INITIAL_WINDOW_SIZE: 1048576",
+		"-> HEADERS stream=1 len=",
+		":path: /echo.EchoServer/SayHello",
+		"grpc message 1: uncompressed, bytes 0-5 of 18, continues in the next frame",
+		"-> DATA stream=1 len=13 END_STREAM",
+		"grpc message 1: uncompressed, bytes 5-18 of 18",
+	)
+}
+
+func TestLogFramesDoesNotBlock(t *testing.T) {
+	out := &logBuffer{block: make(chan struct{})}
+	c := LogFrames(pipe(t), out)
+	defer c.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.WriteString(c, http2.ClientPreface)
+		fr := http2.NewFramer(c, nil)
+		for i := 0; i < 2*feedQueue; i++ {
+			fr.WritePing(false, [8]byte{})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes waited for the frame log")
+	}
+
+	close(out.block)
+	out.waitFor(t, "-> connection preface", "-> PING stream=0", errFellBehind.Error())
+}
@@ -0,0 +1,152 @@
+// Package grpctrace extracts gRPC calls from captured traffic so they can be
+// decoded offline: TCP connections from pcap files, split into HTTP/2 streams
+// and then into the Length-Prefixed-Messages of each call, or the requests and
+// responses recorded by the Envoy TAP filter.
+package grpctrace
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// clientPreface is the first thing an HTTP/2 client sends on a connection
+const clientPreface = http2.ClientPreface
+
+// maxHeaderTableSize is the largest HPACK dynamic table the decoders accept.  The
+// SETTINGS that would say how large it may be could be anywhere in the capture so
+// anything reasonable is allowed.
+const maxHeaderTableSize = 1 << 20
+
+// RPC is one gRPC call: an HTTP/2 stream
+type RPC struct {
+	// Conn describes the connection, eg 127.0.0.1:40122 -> 127.0.0.1:50051, or
+	// where else the call was read from
+	Conn string
+	// StreamID is 0 if the call wasn't read from HTTP/2 frames
+	StreamID uint32
+	// Path is the :path of the request, /package.Service/Method
+	Path string
+	// RequestHeaders, ResponseHeaders and Trailers are the decoded header
+	// blocks, pseudo-headers included.  A Trailers-Only response has no
+	// ResponseHeaders.
+	RequestHeaders  []hpack.HeaderField
+	ResponseHeaders []hpack.HeaderField
+	Trailers        []hpack.HeaderField
+	// RequestData and ResponseData are the contents of the DATA frames in each
+	// direction: the gRPC frames of the call
+	RequestData  []byte
+	ResponseData []byte
+	// RequestTruncated and ResponseTruncated are set when the capture kept only
+	// the start of the data, as Envoy TAP does past max_buffered_rx_bytes
+	RequestTruncated  bool
+	ResponseTruncated bool
+}
+
+// Header returns the first value of the header name in fields
+func Header(fields []hpack.HeaderField, name string) string {
+	for _, f := range fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// ParseHTTP2 splits the two directions of an HTTP/2 connection into its streams.
+// Frames are read until either side's data runs out; a capture that stops part
+// way through a frame keeps everything before it.
+func ParseHTTP2(conn string, client, server []byte) ([]*RPC, error) {
+	if !bytes.HasPrefix(client, []byte(clientPreface)) {
+		return nil, fmt.Errorf("grpctrace: %s: client did not send the HTTP/2 connection preface", conn)
+	}
+	streams := map[uint32]*RPC{}
+	stream := func(id uint32) *RPC {
+		rpc := streams[id]
+		if rpc == nil {
+			rpc = &RPC{Conn: conn, StreamID: id}
+			streams[id] = rpc
+		}
+		return rpc
+	}
+
+	err := readFrames(client[len(clientPreface):], func(f http2.Frame) {
+		switch f := f.(type) {
+		case *http2.MetaHeadersFrame:
+			rpc := stream(f.StreamID)
+			rpc.RequestHeaders = append(rpc.RequestHeaders, f.Fields...)
+			rpc.Path = Header(rpc.RequestHeaders, ":path")
+		case *http2.DataFrame:
+			rpc := stream(f.StreamID)
+			rpc.RequestData = append(rpc.RequestData, f.Data()...)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("grpctrace: %s: client: %w", conn, err)
+	}
+	err = readFrames(server, func(f http2.Frame) {
+		switch f := f.(type) {
+		case *http2.MetaHeadersFrame:
+			rpc := stream(f.StreamID)
+			// the first header block carries the response headers unless it also ends
+			// the stream (Trailers-Only); anything after is the trailers
+			if rpc.ResponseHeaders == nil && !(f.StreamEnded() && Header(f.Fields, "grpc-status") != "") {
+				rpc.ResponseHeaders = f.Fields
+			} else {
+				rpc.Trailers = append(rpc.Trailers, f.Fields...)
+			}
+		case *http2.DataFrame:
+			rpc := stream(f.StreamID)
+			rpc.ResponseData = append(rpc.ResponseData, f.Data()...)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("grpctrace: %s: server: %w", conn, err)
+	}
+
+	rpcs := make([]*RPC, 0, len(streams))
+	for _, rpc := range streams {
+		rpcs = append(rpcs, rpc)
+	}
+	sort.Slice(rpcs, func(i, j int) bool {
+		return rpcs[i].StreamID < rpcs[j].StreamID
+	})
+	return rpcs, nil
+}
+
+// newFramer returns a Framer that reads frames of any size from r and HPACK
+// decodes header blocks with a decoder that lives as long as the connection, as
+// the dynamic table requires
+func newFramer(r io.Reader) *http2.Framer {
+	fr := http2.NewFramer(nil, r)
+	fr.SetMaxReadFrameSize(1<<24 - 1)
+	dec := hpack.NewDecoder(4096, nil)
+	dec.SetAllowedMaxDynamicTableSize(maxHeaderTableSize)
+	fr.ReadMetaHeaders = dec
+	return fr
+}
+
+// readFrames calls fn for each frame in b
+func readFrames(b []byte, fn func(http2.Frame)) error {
+	fr := newFramer(bytes.NewReader(b))
+	for {
+		f, err := fr.ReadFrame()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		var se http2.StreamError
+		if errors.As(err, &se) {
+			// a malformed header block only breaks its own stream
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fn(f)
+	}
+}
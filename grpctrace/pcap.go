@@ -0,0 +1,187 @@
+package grpctrace
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// linkTypeLinuxSLL2 is what tcpdump -i any writes on newer kernels; gopacket
+// doesn't know it so its 20 byte header is stripped by hand
+const (
+	linkTypeLinuxSLL2 = 276
+	sll2HeaderLen     = 20
+)
+
+// Conn is one reassembled TCP connection
+type Conn struct {
+	// Client and Server are the ip:port of each end.  The client is the side that
+	// sent the SYN or, if the capture started later, the HTTP/2 connection preface
+	// or a TLS ClientHello.
+	Client, Server string
+	// ClientData and ServerData are the bytes each side sent, in order, up to the
+	// first gap in the capture
+	ClientData, ServerData []byte
+}
+
+// segment is the payload of one TCP packet
+type segment struct {
+	seq  uint32
+	data []byte
+}
+
+// flow is one direction of a connection
+type flow struct {
+	src, dst string
+	// isn is the sequence number of the first payload byte; set from the SYN if
+	// it was captured
+	isn      uint32
+	haveISN  bool
+	syn      bool
+	segments []segment
+}
+
+// ReadPcap reads a pcap or pcapng capture and reassembles the TCP connections in
+// it, in the order they were first seen
+func ReadPcap(r io.Reader) ([]*Conn, error) {
+	src, err := newCaptureReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	flows := map[string]*flow{}
+	var order []*flow
+	for {
+		lt, data, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// a capture cut off part way through a packet still has everything before it
+			if err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+		pkt := decodePacket(data, lt)
+		if pkt == nil {
+			continue
+		}
+		tcp, _ := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		if tcp == nil {
+			continue
+		}
+		var srcIP, dstIP net.IP
+		switch ip := pkt.NetworkLayer().(type) {
+		case *layers.IPv4:
+			srcIP, dstIP = ip.SrcIP, ip.DstIP
+		case *layers.IPv6:
+			srcIP, dstIP = ip.SrcIP, ip.DstIP
+		default:
+			continue
+		}
+		srcAddr := net.JoinHostPort(srcIP.String(), strconv.Itoa(int(tcp.SrcPort)))
+		dstAddr := net.JoinHostPort(dstIP.String(), strconv.Itoa(int(tcp.DstPort)))
+		key := srcAddr + " " + dstAddr
+		f := flows[key]
+		if f == nil {
+			f = &flow{src: srcAddr, dst: dstAddr}
+			flows[key] = f
+			order = append(order, f)
+		}
+		if tcp.SYN {
+			f.isn = tcp.Seq + 1
+			f.haveISN = true
+			f.syn = !tcp.ACK
+			continue
+		}
+		if len(tcp.Payload) == 0 {
+			continue
+		}
+		if !f.haveISN {
+			f.isn = tcp.Seq
+			f.haveISN = true
+		}
+		f.segments = append(f.segments, segment{seq: tcp.Seq, data: append([]byte(nil), tcp.Payload...)})
+	}
+
+	// pair up the two directions of each connection
+	var conns []*Conn
+	paired := map[*flow]bool{}
+	for _, f := range order {
+		if paired[f] {
+			continue
+		}
+		rev := flows[f.dst+" "+f.src]
+		if rev == nil {
+			rev = &flow{src: f.dst, dst: f.src}
+		}
+		paired[f], paired[rev] = true, true
+
+		client, server := f, rev
+		switch {
+		case rev.syn && !f.syn:
+			client, server = rev, f
+		case f.syn:
+		case bytes.HasPrefix(rev.reassemble(), []byte(clientPreface)) || IsTLS(rev.reassemble()):
+			client, server = rev, f
+		}
+		conns = append(conns, &Conn{
+			Client:     client.src,
+			Server:     client.dst,
+			ClientData: client.reassemble(),
+			ServerData: server.reassemble(),
+		})
+	}
+	return conns, nil
+}
+
+// decodePacket parses the layers of a captured packet, or returns nil for link
+// types gopacket can't decode
+func decodePacket(data []byte, lt uint32) gopacket.Packet {
+	switch {
+	case lt == linkTypeLinuxSLL2:
+		if len(data) < sll2HeaderLen {
+			return nil
+		}
+		var first gopacket.Decoder = layers.LayerTypeIPv4
+		if layers.EthernetType(binary.BigEndian.Uint16(data)) == layers.EthernetTypeIPv6 {
+			first = layers.LayerTypeIPv6
+		}
+		return gopacket.NewPacket(data[sll2HeaderLen:], first, gopacket.NoCopy)
+	case lt > 0xff:
+		return nil
+	}
+	return gopacket.NewPacket(data, layers.LinkType(lt), gopacket.NoCopy)
+}
+
+// reassemble orders the segments by sequence number, dropping retransmitted
+// bytes, and returns the data up to the first gap
+func (f *flow) reassemble() []byte {
+	segs := append([]segment(nil), f.segments...)
+	// sequence numbers relative to the start of the flow so wrap around sorts correctly
+	sort.SliceStable(segs, func(i, j int) bool {
+		return segs[i].seq-f.isn < segs[j].seq-f.isn
+	})
+	var out []byte
+	next := uint32(0)
+	for _, s := range segs {
+		rel := s.seq - f.isn
+		end := rel + uint32(len(s.data))
+		if rel > next {
+			break
+		}
+		if end <= next {
+			continue
+		}
+		out = append(out, s.data[next-rel:]...)
+		next = end
+	}
+	return out
+}
@@ -0,0 +1,116 @@
+package grpctrace
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/http2/hpack"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"main/protoset"
+	"main/rawproto"
+	"main/wireformat"
+)
+
+// Printer writes the calls in a capture with their messages decoded to JSON
+// using the method's descriptors.  Calls to methods the registry doesn't know
+// are decoded without a schema.
+type Printer struct {
+	w   io.Writer
+	reg *protoset.Registry
+}
+
+// NewPrinter returns a Printer that writes to w and looks methods up in reg
+func NewPrinter(w io.Writer, reg *protoset.Registry) *Printer {
+	return &Printer{w: w, reg: reg}
+}
+
+// Print writes the path, headers, messages and trailers of rpc
+func (p *Printer) Print(rpc *RPC) error {
+	var in, out protoreflect.MessageDescriptor
+	if md, err := p.reg.FindMethod(rpc.Path); err == nil {
+		in, out = md.Input(), md.Output()
+	}
+
+	if rpc.StreamID != 0 {
+		fmt.Fprintf(p.w, "%s stream %d: %s\n", rpc.Conn, rpc.StreamID, rpc.Path)
+	} else {
+		fmt.Fprintf(p.w, "%s: %s\n", rpc.Conn, rpc.Path)
+	}
+	p.headers("request headers", rpc.RequestHeaders)
+	p.messages("request", rpc.RequestData, rpc.RequestTruncated, Header(rpc.RequestHeaders, "grpc-encoding"), in)
+	p.headers("response headers", rpc.ResponseHeaders)
+	p.messages("response", rpc.ResponseData, rpc.ResponseTruncated, Header(rpc.ResponseHeaders, "grpc-encoding"), out)
+	p.headers("trailers", rpc.Trailers)
+	_, err := fmt.Fprintln(p.w)
+	return err
+}
+
+func (p *Printer) headers(title string, fields []hpack.HeaderField) {
+	if len(fields) == 0 {
+		return
+	}
+	fmt.Fprintf(p.w, "  %s:\n", title)
+	for _, f := range fields {
+		fmt.Fprintf(p.w, "    %s: %s\n", f.Name, f.Value)
+	}
+}
+
+// messages splits data into gRPC frames and prints each message
+func (p *Printer) messages(title string, data []byte, truncated bool, encoding string, md protoreflect.MessageDescriptor) {
+	dec := wireformat.NewDecoder(bytes.NewReader(data))
+	// no frame can be longer than the data, but a compressed one can inflate past it
+	dec.SetMaxMessageSize(len(data))
+	dec.SetMaxDecompressedSize(wireformat.DefaultMaxMessageSize)
+	if err := dec.SetEncoding(encoding); err != nil {
+		fmt.Fprintf(p.w, "  %s messages: %v\n", title, err)
+		return
+	}
+	for i := 1; ; i++ {
+		msg, err := dec.DecodeMessage()
+		if err == io.EOF {
+			return
+		}
+		if err != nil && truncated {
+			fmt.Fprintf(p.w, "  %s message %d: %v (the capture truncated the data)\n", title, i, err)
+			return
+		}
+		if err != nil {
+			// most likely the capture ended part way through the message
+			fmt.Fprintf(p.w, "  %s message %d: %v\n", title, i, err)
+			return
+		}
+		fmt.Fprintf(p.w, "  %s message %d: %s\n", title, i, p.decode(msg, md))
+	}
+}
+
+// decode returns msg as JSON, or in protoc --decode_raw form if there is no
+// descriptor or it doesn't match
+func (p *Printer) decode(msg []byte, md protoreflect.MessageDescriptor) string {
+	if md != nil {
+		m := dynamicpb.NewMessage(md)
+		err := proto.UnmarshalOptions{Resolver: p.reg}.Unmarshal(msg, m)
+		if err == nil {
+			if b, err := (protojson.MarshalOptions{Resolver: p.reg}).Marshal(m); err == nil {
+				return string(b)
+			}
+		}
+	}
+	fields, err := rawproto.Parse(msg)
+	if err != nil {
+		return fmt.Sprintf("%x (%v)", msg, err)
+	}
+	var sb strings.Builder
+	rawproto.Format(&sb, fields)
+	return "\n" + indent(sb.String(), "    ")
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	return prefix + strings.Join(lines, "\n"+prefix)
+}
@@ -0,0 +1,50 @@
+package grpctrace
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2/hpack"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"main/protoset"
+	"main/wireformat"
+)
+
+func TestPrintCompressed(t *testing.T) {
+	reg := protoset.NewRegistry()
+	if _, err := reg.Load("../grpc_services/src/echo/echo.pb"); err != nil {
+		t.Fatal(err)
+	}
+
+	// echo.EchoRequest{first_name: "aaa..."}, which gzip shrinks to a fraction
+	// of its size
+	name := strings.Repeat("a", 1000)
+	msg := protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), name)
+	var data bytes.Buffer
+	enc := wireformat.NewEncoder(&data)
+	if err := enc.SetEncoding("gzip"); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.EncodeMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	if data.Len() >= len(msg) {
+		t.Fatalf("the compressed frame is %d bytes, the message %d", data.Len(), len(msg))
+	}
+
+	var out bytes.Buffer
+	err := NewPrinter(&out, reg).Print(&RPC{
+		Conn:           "test",
+		Path:           "/echo.EchoServer/SayHello",
+		RequestHeaders: []hpack.HeaderField{{Name: "grpc-encoding", Value: "gzip"}},
+		RequestData:    data.Bytes(),
+	})
+	if err != nil {
+		t.Fatalf("Print() error: %v", err)
+	}
+	if !strings.Contains(out.String(), `"firstName":`) || !strings.Contains(out.String(), `"`+name+`"`) {
+		t.Errorf("Print() didn't decode the message:\n%s", out.String())
+	}
+}
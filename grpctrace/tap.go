@@ -0,0 +1,370 @@
+package grpctrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/net/http2/hpack"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The Envoy TAP filter writes envoy.data.tap.v3.TraceWrapper messages.  Only the
+// HTTP traces are read here, so rather than depend on go-control-plane for the
+// generated types the few messages involved are declared below, with the JSON
+// names Envoy writes and the field numbers from envoy/data/tap/v3.
+
+// tapTrace is a TraceWrapper
+type tapTrace struct {
+	HTTPBufferedTrace        *tapBufferedTrace `json:"http_buffered_trace"`         // 1
+	HTTPStreamedTraceSegment *tapSegment       `json:"http_streamed_trace_segment"` // 2
+}
+
+// tapBufferedTrace is an HttpBufferedTrace, a whole request and response
+type tapBufferedTrace struct {
+	Request  *tapMessage `json:"request"`  // 1
+	Response *tapMessage `json:"response"` // 2
+}
+
+type tapMessage struct {
+	Headers  []tapHeader `json:"headers"`  // 1
+	Body     *tapBody    `json:"body"`     // 2
+	Trailers []tapHeader `json:"trailers"` // 3
+}
+
+// tapSegment is an HttpStreamedTraceSegment: one piece of a streamed trace,
+// with the id that ties the pieces together
+type tapSegment struct {
+	TraceID           json.Number   `json:"trace_id"`            // 1
+	RequestHeaders    *tapHeaderMap `json:"request_headers"`     // 2
+	RequestBodyChunk  *tapBody      `json:"request_body_chunk"`  // 3
+	RequestTrailers   *tapHeaderMap `json:"request_trailers"`    // 4
+	ResponseHeaders   *tapHeaderMap `json:"response_headers"`    // 5
+	ResponseBodyChunk *tapBody      `json:"response_body_chunk"` // 6
+	ResponseTrailers  *tapHeaderMap `json:"response_trailers"`   // 7
+}
+
+type tapHeaderMap struct {
+	Headers []tapHeader `json:"headers"` // 1
+}
+
+// tapHeader is a config.core.v3.HeaderValue.  Newer Envoys put the value in
+// raw_value.
+type tapHeader struct {
+	Key      string `json:"key"`       // 1
+	Value    string `json:"value"`     // 2
+	RawValue []byte `json:"raw_value"` // 3
+}
+
+// tapBody is a Body.  With JSON_BODY_AS_STRING Envoy replaces invalid UTF-8 so
+// gRPC messages only survive JSON_BODY_AS_BYTES (or a proto format).
+type tapBody struct {
+	AsBytes   []byte  `json:"as_bytes"`  // 1
+	AsString  *string `json:"as_string"` // 2
+	Truncated bool    `json:"truncated"` // 3
+}
+
+func (b *tapBody) data() []byte {
+	if b.AsString != nil {
+		return []byte(*b.AsString)
+	}
+	return b.AsBytes
+}
+
+func headerFields(hs []tapHeader) []hpack.HeaderField {
+	var fields []hpack.HeaderField
+	for _, h := range hs {
+		v := h.Value
+		if h.RawValue != nil {
+			v = string(h.RawValue)
+		}
+		fields = append(fields, hpack.HeaderField{Name: h.Key, Value: v})
+	}
+	return fields
+}
+
+// ReadTap reads the output of the Envoy TAP filter: JSON (JSON_BODY_AS_BYTES or
+// JSON_BODY_AS_STRING), PROTO_BINARY or PROTO_BINARY_LENGTH_DELIMITED, holding
+// buffered traces or the segments of streamed ones.  Segments are put back
+// together by trace id.  name is used as the RPC's Conn.
+func ReadTap(name string, r io.Reader) ([]*RPC, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var traces []*tapTrace
+	switch {
+	case bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")):
+		traces, err = readTapJSON(b)
+	case strings.HasSuffix(name, ".pb_length_delimited"):
+		traces, err = readTapDelimited(b)
+	default:
+		traces, err = readTapProto(b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("grpctrace: %s: %w", name, err)
+	}
+
+	var rpcs []*RPC
+	streamed := map[string]*RPC{}
+	for _, t := range traces {
+		switch {
+		case t.HTTPBufferedTrace != nil:
+			rpcs = append(rpcs, bufferedRPC(name, t.HTTPBufferedTrace))
+		case t.HTTPStreamedTraceSegment != nil:
+			seg := t.HTTPStreamedTraceSegment
+			rpc := streamed[seg.TraceID.String()]
+			if rpc == nil {
+				rpc = &RPC{Conn: name + " trace " + seg.TraceID.String()}
+				streamed[seg.TraceID.String()] = rpc
+				rpcs = append(rpcs, rpc)
+			}
+			addSegment(rpc, seg)
+		}
+	}
+	if len(rpcs) == 0 {
+		return nil, fmt.Errorf("grpctrace: %s: no HTTP traces", name)
+	}
+	return rpcs, nil
+}
+
+func bufferedRPC(name string, t *tapBufferedTrace) *RPC {
+	rpc := &RPC{Conn: name}
+	if req := t.Request; req != nil {
+		rpc.RequestHeaders = headerFields(req.Headers)
+		if req.Body != nil {
+			rpc.RequestData = req.Body.data()
+			rpc.RequestTruncated = req.Body.Truncated
+		}
+	}
+	if resp := t.Response; resp != nil {
+		rpc.ResponseHeaders = headerFields(resp.Headers)
+		rpc.Trailers = headerFields(resp.Trailers)
+		if resp.Body != nil {
+			rpc.ResponseData = resp.Body.data()
+			rpc.ResponseTruncated = resp.Body.Truncated
+		}
+	}
+	rpc.Path = Header(rpc.RequestHeaders, ":path")
+	return rpc
+}
+
+func addSegment(rpc *RPC, seg *tapSegment) {
+	switch {
+	case seg.RequestHeaders != nil:
+		rpc.RequestHeaders = append(rpc.RequestHeaders, headerFields(seg.RequestHeaders.Headers)...)
+		rpc.Path = Header(rpc.RequestHeaders, ":path")
+	case seg.RequestBodyChunk != nil:
+		rpc.RequestData = append(rpc.RequestData, seg.RequestBodyChunk.data()...)
+		rpc.RequestTruncated = rpc.RequestTruncated || seg.RequestBodyChunk.Truncated
+	case seg.RequestTrailers != nil:
+		// gRPC clients don't send trailers; kept with the request headers if one does
+		rpc.RequestHeaders = append(rpc.RequestHeaders, headerFields(seg.RequestTrailers.Headers)...)
+	case seg.ResponseHeaders != nil:
+		rpc.ResponseHeaders = append(rpc.ResponseHeaders, headerFields(seg.ResponseHeaders.Headers)...)
+	case seg.ResponseBodyChunk != nil:
+		rpc.ResponseData = append(rpc.ResponseData, seg.ResponseBodyChunk.data()...)
+		rpc.ResponseTruncated = rpc.ResponseTruncated || seg.ResponseBodyChunk.Truncated
+	case seg.ResponseTrailers != nil:
+		rpc.Trailers = append(rpc.Trailers, headerFields(seg.ResponseTrailers.Headers)...)
+	}
+}
+
+// readTapJSON reads one or more TraceWrapper objects; a streamed trace is
+// written as one object per segment
+func readTapJSON(b []byte) ([]*tapTrace, error) {
+	var traces []*tapTrace
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for {
+		t := &tapTrace{}
+		err := dec.Decode(t)
+		if err == io.EOF {
+			return traces, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		traces = append(traces, t)
+	}
+}
+
+// readTapDelimited reads TraceWrapper messages each prefixed with its length as
+// a varint
+func readTapDelimited(b []byte) ([]*tapTrace, error) {
+	var traces []*tapTrace
+	for len(b) > 0 {
+		msg, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		ts, err := readTapProto(msg)
+		if err != nil {
+			return nil, err
+		}
+		traces = append(traces, ts...)
+		b = b[n:]
+	}
+	return traces, nil
+}
+
+// walkFields calls fn with the number and value of each field in b: the
+// contents of length-delimited fields and the value of varints.  Other fields
+// are skipped.
+func walkFields(b []byte, fn func(num protowire.Number, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var v []byte
+		var x uint64
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType && typ != protowire.VarintType {
+			continue
+		}
+		if err := fn(num, v, x); err != nil {
+			return fmt.Errorf("field %d: %w", num, err)
+		}
+	}
+	return nil
+}
+
+// readTapProto reads TraceWrapper messages.  A streamed trace in PROTO_BINARY is
+// written as one message per segment with nothing in between, which parses the
+// same as a single message with the trace field repeated, so every occurrence
+// of the field is returned as a trace of its own.
+func readTapProto(b []byte) ([]*tapTrace, error) {
+	var traces []*tapTrace
+	err := walkFields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		var err error
+		t := &tapTrace{}
+		switch num {
+		case 1:
+			t.HTTPBufferedTrace = &tapBufferedTrace{}
+			err = walkFields(v, func(num protowire.Number, v []byte, _ uint64) error {
+				var err error
+				switch num {
+				case 1:
+					t.HTTPBufferedTrace.Request, err = readTapMessage(v)
+				case 2:
+					t.HTTPBufferedTrace.Response, err = readTapMessage(v)
+				}
+				return err
+			})
+		case 2:
+			t.HTTPStreamedTraceSegment, err = readTapSegment(v)
+		default:
+			return nil
+		}
+		traces = append(traces, t)
+		return err
+	})
+	return traces, err
+}
+
+func readTapMessage(b []byte) (*tapMessage, error) {
+	m := &tapMessage{}
+	err := walkFields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		var err error
+		switch num {
+		case 1, 3:
+			var h tapHeader
+			h, err = readTapHeader(v)
+			if num == 1 {
+				m.Headers = append(m.Headers, h)
+			} else {
+				m.Trailers = append(m.Trailers, h)
+			}
+		case 2:
+			m.Body, err = readTapBody(v)
+		}
+		return err
+	})
+	return m, err
+}
+
+func readTapSegment(b []byte) (*tapSegment, error) {
+	s := &tapSegment{}
+	err := walkFields(b, func(num protowire.Number, v []byte, x uint64) error {
+		var err error
+		switch num {
+		case 1:
+			s.TraceID = json.Number(fmt.Sprint(x))
+		case 2:
+			s.RequestHeaders, err = readTapHeaderMap(v)
+		case 3:
+			s.RequestBodyChunk, err = readTapBody(v)
+		case 4:
+			s.RequestTrailers, err = readTapHeaderMap(v)
+		case 5:
+			s.ResponseHeaders, err = readTapHeaderMap(v)
+		case 6:
+			s.ResponseBodyChunk, err = readTapBody(v)
+		case 7:
+			s.ResponseTrailers, err = readTapHeaderMap(v)
+		}
+		return err
+	})
+	return s, err
+}
+
+func readTapHeaderMap(b []byte) (*tapHeaderMap, error) {
+	hm := &tapHeaderMap{}
+	err := walkFields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		if num != 1 {
+			return nil
+		}
+		h, err := readTapHeader(v)
+		hm.Headers = append(hm.Headers, h)
+		return err
+	})
+	return hm, err
+}
+
+func readTapHeader(b []byte) (tapHeader, error) {
+	var h tapHeader
+	err := walkFields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			h.Key = string(v)
+		case 2:
+			h.Value = string(v)
+		case 3:
+			h.RawValue = append([]byte{}, v...)
+		}
+		return nil
+	})
+	return h, err
+}
+
+func readTapBody(b []byte) (*tapBody, error) {
+	body := &tapBody{}
+	err := walkFields(b, func(num protowire.Number, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			body.AsBytes = append([]byte{}, v...)
+		case 2:
+			s := string(v)
+			body.AsString = &s
+		case 3:
+			body.Truncated = x != 0
+		}
+		return nil
+	})
+	return body, err
+}
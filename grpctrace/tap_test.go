@@ -0,0 +1,75 @@
+package grpctrace
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The files in testdata hold one echo call as the TAP filter would write it.
+// The .pb and .pb_length_delimited files were made from the .json ones with
+// protojson and Envoy's envoy/data/tap/v3 descriptors; the request body of the
+// streamed trace is split over two chunks.
+func TestReadTap(t *testing.T) {
+	for _, name := range []string{
+		"tap_buffered.json",
+		"tap_buffered.pb",
+		"tap_buffered.pb_length_delimited",
+		"tap_streamed.json",
+		"tap_streamed.pb",
+		"tap_streamed.pb_length_delimited",
+	} {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			rpcs, err := ReadTap(name, f)
+			if err != nil {
+				t.Fatalf("ReadTap() error: %v", err)
+			}
+			if len(rpcs) != 1 {
+				t.Fatalf("ReadTap() returned %d calls, want 1", len(rpcs))
+			}
+			rpc := rpcs[0]
+
+			wantConn := name
+			if strings.HasPrefix(name, "tap_streamed") {
+				wantConn += " trace 5"
+			}
+			if rpc.Conn != wantConn {
+				t.Errorf("Conn = %q, want %q", rpc.Conn, wantConn)
+			}
+			if rpc.Path != "/echo.EchoServer/SayHello" {
+				t.Errorf("Path = %q, want /echo.EchoServer/SayHello", rpc.Path)
+			}
+			if got := Header(rpc.RequestHeaders, "content-type"); got != "application/grpc" {
+				t.Errorf("request content-type = %q, want application/grpc", got)
+			}
+			if got := Header(rpc.ResponseHeaders, ":status"); got != "200" {
+				t.Errorf(":status = %q, want 200", got)
+			}
+			if !bytes.Equal(rpc.RequestData, requestFrame) {
+				t.Errorf("RequestData = %x, want %x", rpc.RequestData, requestFrame)
+			}
+			if !bytes.Equal(rpc.ResponseData, responseFrame) {
+				t.Errorf("ResponseData = %x, want %x", rpc.ResponseData, responseFrame)
+			}
+			if got := Header(rpc.Trailers, "grpc-status"); got != "0" {
+				t.Errorf("grpc-status trailer = %q, want 0", got)
+			}
+			if rpc.RequestTruncated || rpc.ResponseTruncated {
+				t.Errorf("the bodies are marked truncated")
+			}
+		})
+	}
+
+	t.Run("no traces", func(t *testing.T) {
+		if _, err := ReadTap("empty.json", strings.NewReader("{}")); err == nil {
+			t.Errorf("ReadTap() succeeded without any HTTP traces")
+		}
+	})
+}
@@ -0,0 +1,437 @@
+package grpctrace
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	// register the hashes the cipher suites use
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// TLS record content types and handshake message types
+const (
+	recordChangeCipherSpec = 20
+	recordAlert            = 21
+	recordHandshake        = 22
+	recordApplicationData  = 23
+	recordHeaderLen        = 5
+
+	handshakeClientHello = 1
+	handshakeServerHello = 2
+	handshakeFinished    = 20
+	handshakeKeyUpdate   = 24
+
+	extensionSupportedVersions = 43
+)
+
+// helloRetryRequest is the ServerHello random that marks a HelloRetryRequest
+var helloRetryRequest = []byte{
+	0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11, 0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+	0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e, 0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xa8, 0x33, 0x9c,
+}
+
+// ErrNoKeys is returned for TLS connections whose secrets aren't in the key log
+var ErrNoKeys = errors.New("grpctrace: no key log entry for the connection")
+
+// KeyLog holds the secrets from an NSS key log file (SSLKEYLOGFILE), by label
+// and then hex encoded client random
+type KeyLog struct {
+	secrets map[string]map[string][]byte
+}
+
+// ReadKeyLog parses an NSS key log file.  Comments and labels other than the TLS
+// 1.2 CLIENT_RANDOM and the TLS 1.3 traffic secrets are ignored.
+func ReadKeyLog(r io.Reader) (*KeyLog, error) {
+	kl := &KeyLog{secrets: map[string]map[string][]byte{}}
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("grpctrace: key log line %d: want label, client random and secret", line)
+		}
+		secret, err := hex.DecodeString(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("grpctrace: key log line %d: %v", line, err)
+		}
+		if kl.secrets[fields[0]] == nil {
+			kl.secrets[fields[0]] = map[string][]byte{}
+		}
+		kl.secrets[fields[0]][strings.ToLower(fields[1])] = secret
+	}
+	return kl, s.Err()
+}
+
+func (kl *KeyLog) secret(label string, clientRandom []byte) []byte {
+	return kl.secrets[label][hex.EncodeToString(clientRandom)]
+}
+
+// IsTLS is true if data starts with a TLS record holding a ClientHello, as the
+// client side of a TLS connection does
+func IsTLS(data []byte) bool {
+	return len(data) > recordHeaderLen && data[0] == recordHandshake && data[1] == 3 && data[recordHeaderLen] == handshakeClientHello
+}
+
+// record is one TLS record
+type record struct {
+	typ     byte
+	header  []byte
+	payload []byte
+}
+
+// readRecords splits b into TLS records, stopping at a truncated one
+func readRecords(b []byte) []record {
+	var recs []record
+	for len(b) >= recordHeaderLen {
+		n := recordHeaderLen + int(binary.BigEndian.Uint16(b[3:]))
+		if len(b) < n {
+			break
+		}
+		recs = append(recs, record{typ: b[0], header: b[:recordHeaderLen], payload: b[recordHeaderLen:n]})
+		b = b[n:]
+	}
+	return recs
+}
+
+// handshakeMessages splits the contents of handshake records into messages,
+// returning what is left of a message that continues in the next record
+func handshakeMessages(b []byte, fn func(typ byte, body []byte)) []byte {
+	for len(b) >= 4 {
+		n := 4 + (int(b[1])<<16 | int(b[2])<<8 | int(b[3]))
+		if len(b) < n {
+			break
+		}
+		fn(b[0], b[4:n])
+		b = b[n:]
+	}
+	return b
+}
+
+// hello is what DecryptTLS needs from the ClientHello and ServerHello
+type hello struct {
+	clientRandom, serverRandom []byte
+	suite                      uint16
+	tls13                      bool
+}
+
+// readHellos finds the ClientHello and ServerHello among the plaintext handshake
+// records at the start of each side
+func readHellos(client, server []byte) (*hello, error) {
+	h := &hello{}
+	var buf []byte
+	for _, rec := range readRecords(client) {
+		if rec.typ != recordHandshake || h.clientRandom != nil {
+			break
+		}
+		buf = handshakeMessages(append(buf, rec.payload...), func(typ byte, body []byte) {
+			if typ == handshakeClientHello && len(body) >= 34 {
+				h.clientRandom = body[2:34]
+			}
+		})
+	}
+	if h.clientRandom == nil {
+		return nil, errors.New("grpctrace: no ClientHello")
+	}
+
+	buf = nil
+	for _, rec := range readRecords(server) {
+		if rec.typ != recordHandshake || h.serverRandom != nil {
+			break
+		}
+		buf = handshakeMessages(append(buf, rec.payload...), func(typ byte, body []byte) {
+			if typ != handshakeServerHello || h.serverRandom != nil || len(body) < 35 {
+				return
+			}
+			random := body[2:34]
+			if bytes.Equal(random, helloRetryRequest) {
+				// the real ServerHello follows the client's second ClientHello
+				return
+			}
+			// skip the session id; a corrupt length skips the message
+			if 35+int(body[34])+3 > len(body) {
+				return
+			}
+			rest := body[35+int(body[34]):]
+			h.serverRandom = random
+			h.suite = binary.BigEndian.Uint16(rest)
+			h.tls13 = serverSupportedVersion(rest[3:]) == tls.VersionTLS13
+		})
+	}
+	if h.serverRandom == nil {
+		return nil, errors.New("grpctrace: no ServerHello")
+	}
+	return h, nil
+}
+
+// serverSupportedVersion returns the version in the supported_versions extension
+// of a ServerHello, which is how TLS 1.3 is negotiated
+func serverSupportedVersion(exts []byte) uint16 {
+	if len(exts) < 2 {
+		return 0
+	}
+	exts = exts[2:]
+	for len(exts) >= 4 {
+		typ := binary.BigEndian.Uint16(exts)
+		n := 4 + int(binary.BigEndian.Uint16(exts[2:]))
+		if len(exts) < n {
+			break
+		}
+		if typ == extensionSupportedVersions && n == 6 {
+			return binary.BigEndian.Uint16(exts[4:])
+		}
+		exts = exts[n:]
+	}
+	return 0
+}
+
+// suiteParams returns the key length and hash of the AES-GCM cipher suites, the
+// only ones DecryptTLS supports.  Go picks these whenever the CPU has AES
+// instructions.
+func suiteParams(suite uint16) (int, crypto.Hash, error) {
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_RSA_WITH_AES_128_GCM_SHA256:
+		return 16, crypto.SHA256, nil
+	case tls.TLS_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_RSA_WITH_AES_256_GCM_SHA384:
+		return 32, crypto.SHA384, nil
+	}
+	return 0, 0, fmt.Errorf("grpctrace: can't decrypt cipher suite %s", tls.CipherSuiteName(suite))
+}
+
+// DecryptTLS returns the application data each side of a TLS 1.2 or 1.3
+// connection sent, using the secrets the client logged.  Like the TCP
+// reassembly it stops at the first record it can't read.
+func DecryptTLS(client, server []byte, keys *KeyLog) (clientData, serverData []byte, err error) {
+	h, err := readHellos(client, server)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyLen, hash, err := suiteParams(h.suite)
+	if err != nil {
+		return nil, nil, err
+	}
+	if h.tls13 {
+		clientData, err = decryptTLS13(client, hash, keyLen,
+			keys.secret("CLIENT_HANDSHAKE_TRAFFIC_SECRET", h.clientRandom),
+			keys.secret("CLIENT_TRAFFIC_SECRET_0", h.clientRandom))
+		serverData, serverErr := decryptTLS13(server, hash, keyLen,
+			keys.secret("SERVER_HANDSHAKE_TRAFFIC_SECRET", h.clientRandom),
+			keys.secret("SERVER_TRAFFIC_SECRET_0", h.clientRandom))
+		if err == nil {
+			err = serverErr
+		}
+		return clientData, serverData, err
+	}
+
+	master := keys.secret("CLIENT_RANDOM", h.clientRandom)
+	if master == nil {
+		return nil, nil, ErrNoKeys
+	}
+	// client write key, server write key, client and server implicit nonces
+	kb := prf12(hash.New, master, "key expansion", append(append([]byte(nil), h.serverRandom...), h.clientRandom...), 2*keyLen+8)
+	clientData, err = decryptTLS12(client, kb[:keyLen], kb[2*keyLen:2*keyLen+4])
+	serverData, serverErr := decryptTLS12(server, kb[keyLen:2*keyLen], kb[2*keyLen+4:])
+	if err == nil {
+		err = serverErr
+	}
+	return clientData, serverData, err
+}
+
+// halfConn decrypts the records one side sends
+type halfConn struct {
+	aead cipher.AEAD
+	iv   []byte
+	seq  uint64
+}
+
+func newHalfConn(key, iv []byte) (*halfConn, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &halfConn{aead: aead, iv: iv}, nil
+}
+
+// open13 decrypts a TLS 1.3 record and strips the padding, returning the real
+// content type
+func (hc *halfConn) open13(rec record) (byte, []byte, error) {
+	nonce := append([]byte(nil), hc.iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(hc.seq >> (8 * i))
+	}
+	plain, err := hc.aead.Open(nil, nonce, rec.payload, rec.header)
+	if err != nil {
+		return 0, nil, fmt.Errorf("grpctrace: record %d: %v", hc.seq, err)
+	}
+	hc.seq++
+	plain = bytes.TrimRight(plain, "\x00")
+	if len(plain) == 0 {
+		return 0, nil, fmt.Errorf("grpctrace: record %d has no content type", hc.seq-1)
+	}
+	return plain[len(plain)-1], plain[:len(plain)-1], nil
+}
+
+// open12 decrypts a TLS 1.2 AES-GCM record, whose nonce is the implicit part
+// from the key block followed by the explicit part at the start of the record
+func (hc *halfConn) open12(rec record) ([]byte, error) {
+	explicit := 8
+	if len(rec.payload) < explicit+hc.aead.Overhead() {
+		return nil, fmt.Errorf("grpctrace: record %d is too short", hc.seq)
+	}
+	nonce := append(append([]byte(nil), hc.iv...), rec.payload[:explicit]...)
+	ad := make([]byte, 13)
+	binary.BigEndian.PutUint64(ad, hc.seq)
+	copy(ad[8:], rec.header[:3])
+	binary.BigEndian.PutUint16(ad[11:], uint16(len(rec.payload)-explicit-hc.aead.Overhead()))
+	plain, err := hc.aead.Open(nil, nonce, rec.payload[explicit:], ad)
+	if err != nil {
+		return nil, fmt.Errorf("grpctrace: record %d: %v", hc.seq, err)
+	}
+	hc.seq++
+	return plain, nil
+}
+
+// decryptTLS13 decrypts one side of a TLS 1.3 connection: handshake records up
+// to Finished with the handshake secret, then application data with the traffic
+// secret and whatever KeyUpdates replace it with
+func decryptTLS13(b []byte, hash crypto.Hash, keyLen int, handshakeSecret, trafficSecret []byte) ([]byte, error) {
+	if handshakeSecret == nil || trafficSecret == nil {
+		return nil, ErrNoKeys
+	}
+	secret := handshakeSecret
+	hc, err := newHalfConn13(hash, keyLen, secret)
+	if err != nil {
+		return nil, err
+	}
+	var out, hs []byte
+	for _, rec := range readRecords(b) {
+		// the hellos and the middlebox compatibility ChangeCipherSpec are not encrypted
+		if rec.typ != recordApplicationData {
+			continue
+		}
+		typ, plain, err := hc.open13(rec)
+		if err != nil {
+			return out, err
+		}
+		switch typ {
+		case recordApplicationData:
+			out = append(out, plain...)
+		case recordAlert:
+			return out, nil
+		case recordHandshake:
+			var next []byte
+			hs = handshakeMessages(append(hs, plain...), func(typ byte, body []byte) {
+				switch {
+				case typ == handshakeFinished && bytes.Equal(secret, handshakeSecret):
+					next = trafficSecret
+				case typ == handshakeKeyUpdate:
+					next = expandLabel(hash, secret, "traffic upd", hash.Size())
+				}
+			})
+			if next != nil {
+				secret = next
+				hc, err = newHalfConn13(hash, keyLen, secret)
+				if err != nil {
+					return out, err
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+func newHalfConn13(hash crypto.Hash, keyLen int, secret []byte) (*halfConn, error) {
+	return newHalfConn(expandLabel(hash, secret, "key", keyLen), expandLabel(hash, secret, "iv", 12))
+}
+
+// decryptTLS12 decrypts one side of a TLS 1.2 connection.  Records are encrypted
+// from the ChangeCipherSpec on, starting with Finished.
+func decryptTLS12(b []byte, key, iv []byte) ([]byte, error) {
+	hc, err := newHalfConn(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	encrypted := false
+	for _, rec := range readRecords(b) {
+		if rec.typ == recordChangeCipherSpec {
+			encrypted = true
+			continue
+		}
+		if !encrypted {
+			continue
+		}
+		plain, err := hc.open12(rec)
+		if err != nil {
+			return out, err
+		}
+		switch rec.typ {
+		case recordApplicationData:
+			out = append(out, plain...)
+		case recordAlert:
+			return out, nil
+		}
+	}
+	return out, nil
+}
+
+// expandLabel is HKDF-Expand-Label from RFC 8446 with an empty context
+func expandLabel(hash crypto.Hash, secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := []byte{byte(length >> 8), byte(length), byte(len(label))}
+	info = append(info, label...)
+	info = append(info, 0)
+
+	// HKDF-Expand: T(i) = HMAC(secret, T(i-1) | info | i)
+	var out, t []byte
+	for i := byte(1); len(out) < length; i++ {
+		mac := hmac.New(hash.New, secret)
+		mac.Write(t)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		t = mac.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:length]
+}
+
+// prf12 is the TLS 1.2 PRF from RFC 5246, P_hash(secret, label | seed)
+func prf12(h func() hash.Hash, secret []byte, label string, seed []byte, length int) []byte {
+	seed = append([]byte(label), seed...)
+	var out []byte
+	a := seed
+	for len(out) < length {
+		mac := hmac.New(h, secret)
+		mac.Write(a)
+		a = mac.Sum(nil)
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		out = append(out, mac.Sum(nil)...)
+	}
+	return out[:length]
+}
@@ -0,0 +1,237 @@
+package grpctrace
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+var (
+	// echo.EchoRequest{first_name: "sal", last_name: "mander", middle_name: {name: "a"}}
+	requestFrame, _ = hex.DecodeString("00000000120a0373616c12066d616e6465721a030a0161")
+	// echo.EchoReply{message: "Hello sal a mander"}
+	responseFrame, _ = hex.DecodeString("00000000140a1248656c6c6f2073616c2061206d616e646572")
+)
+
+func TestDecryptTLS(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxVersion uint16
+		suites     []uint16
+	}{
+		{"TLS 1.2 AES-128-GCM", tls.VersionTLS12, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}},
+		{"TLS 1.2 AES-256-GCM", tls.VersionTLS12, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}},
+		// the TLS 1.3 suite can't be configured; Go picks AES-128-GCM on CPUs with AES instructions
+		{"TLS 1.3", tls.VersionTLS13, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server, keyLog := recordCall(t, tt.maxVersion, tt.suites)
+			if !IsTLS(client) {
+				t.Fatalf("IsTLS() = false for the client side")
+			}
+			if IsTLS(server) {
+				t.Fatalf("IsTLS() = true for the server side")
+			}
+
+			keys, err := ReadKeyLog(strings.NewReader(keyLog))
+			if err != nil {
+				t.Fatalf("ReadKeyLog() error: %v", err)
+			}
+			clientData, serverData, err := DecryptTLS(client, server, keys)
+			if err != nil && strings.Contains(err.Error(), "can't decrypt cipher suite") {
+				t.Skipf("negotiated a suite DecryptTLS doesn't support: %v", err)
+			}
+			if err != nil {
+				t.Fatalf("DecryptTLS() error: %v", err)
+			}
+
+			rpcs, err := ParseHTTP2("test", clientData, serverData)
+			if err != nil {
+				t.Fatalf("ParseHTTP2() error: %v", err)
+			}
+			if len(rpcs) != 1 {
+				t.Fatalf("ParseHTTP2() returned %d calls, want 1", len(rpcs))
+			}
+			rpc := rpcs[0]
+			if rpc.Path != "/echo.EchoServer/SayHello" {
+				t.Errorf("Path = %q, want /echo.EchoServer/SayHello", rpc.Path)
+			}
+			if !bytes.Equal(rpc.RequestData, requestFrame) {
+				t.Errorf("RequestData = %x, want %x", rpc.RequestData, requestFrame)
+			}
+			if !bytes.Equal(rpc.ResponseData, responseFrame) {
+				t.Errorf("ResponseData = %x, want %x", rpc.ResponseData, responseFrame)
+			}
+			if got := Header(rpc.Trailers, "grpc-status"); got != "0" {
+				t.Errorf("grpc-status trailer = %q, want 0", got)
+			}
+		})
+	}
+
+	t.Run("no keys", func(t *testing.T) {
+		client, server, _ := recordCall(t, tls.VersionTLS13, nil)
+		keys, _ := ReadKeyLog(strings.NewReader(""))
+		if _, _, err := DecryptTLS(client, server, keys); err != ErrNoKeys {
+			t.Errorf("DecryptTLS() error = %v, want ErrNoKeys", err)
+		}
+	})
+}
+
+// recordCall makes one unary echo call over TLS and HTTP/2 and returns what the
+// client sent and received, as a capture would have it, and the key log
+func recordCall(t *testing.T, maxVersion uint16, suites []uint16) (client, server []byte, keyLog string) {
+	t.Helper()
+	cert, pool := testCertificate(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	tlsLn := tls.NewListener(ln, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{http2.NextProtoTLS},
+		MaxVersion:   maxVersion,
+		CipherSuites: suites,
+	})
+	h2 := &http2.Server{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set("content-type", "application/grpc")
+		w.Header().Set("trailer", "grpc-status")
+		w.Write(responseFrame)
+		w.Header().Set("grpc-status", "0")
+	})
+	go func() {
+		for {
+			c, err := tlsLn.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				// http2.Server wants the negotiated protocol, so the handshake has to be done
+				if err := c.(*tls.Conn).Handshake(); err != nil {
+					c.Close()
+					return
+				}
+				h2.ServeConn(c, &http2.ServeConnOpts{Handler: handler})
+			}()
+		}
+	}()
+
+	var keys bytes.Buffer
+	rec := &recorder{}
+	tr := &http2.Transport{
+		TLSClientConfig: &tls.Config{
+			RootCAs:      pool,
+			ServerName:   "localhost",
+			KeyLogWriter: &keys,
+		},
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			c, err := net.Dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			rec.Conn = c
+			tc := tls.Client(rec, cfg)
+			return tc, tc.Handshake()
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	req, err := http.NewRequest("POST", "https://"+ln.Addr().String()+"/echo.EchoServer/SayHello", bytes.NewReader(requestFrame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("content-type", "application/grpc")
+	req.Header.Set("te", "trailers")
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error: %v", err)
+	}
+	// the trailers have arrived once the body is read to EOF
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.Trailer.Get("grpc-status") != "0" {
+		t.Fatalf("call failed: trailers %v", resp.Trailer)
+	}
+
+	client, server = rec.bytes()
+	return client, server, keys.String()
+}
+
+// recorder keeps a copy of everything written to and read from the connection
+type recorder struct {
+	net.Conn
+	mu            sync.Mutex
+	sent, receive bytes.Buffer
+}
+
+func (r *recorder) Read(b []byte) (int, error) {
+	n, err := r.Conn.Read(b)
+	r.mu.Lock()
+	r.receive.Write(b[:n])
+	r.mu.Unlock()
+	return n, err
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	n, err := r.Conn.Write(b)
+	r.mu.Lock()
+	r.sent.Write(b[:n])
+	r.mu.Unlock()
+	return n, err
+}
+
+func (r *recorder) bytes() (sent, received []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]byte(nil), r.sent.Bytes()...), append([]byte(nil), r.receive.Bytes()...)
+}
+
+// testCertificate returns a self-signed ECDSA certificate for localhost, so the
+// ECDHE_ECDSA suites can be negotiated, and a pool that trusts it
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
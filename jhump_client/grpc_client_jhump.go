@@ -32,6 +32,8 @@ var (
 	addr            = flag.String("addr", "localhost:50051", "host:port of grpc server")
 	protoImportPath = flag.String("protoImportPath", "../grpc_services/src/echo/", "path to .proto file")
 	serverName      = flag.String("servername", "localhost", "SNI for server")
+	clientCert      = flag.String("cert", "", "client certificate for mTLS")
+	clientKey       = flag.String("key", "", "client key for mTLS")
 )
 
 func main() {
@@ -114,6 +116,13 @@ func main() {
 		ServerName: *serverName,
 		RootCAs:    caCertPool,
 	}
+	if *clientCert != "" || *clientKey != "" {
+		certificate, err := tls.LoadX509KeyPair(*clientCert, *clientKey)
+		if err != nil {
+			panic(fmt.Errorf("could not load client key pair: %v", err))
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
 
 	creds := credentials.NewTLS(&tlsConfig)
 
@@ -0,0 +1,45 @@
+package protoset
+
+import (
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Compile parses .proto source files, resolving imports against importPaths, and
+// registers the result the same way Load registers a FileDescriptorSet from protoc.
+// The well-known types (google/protobuf/*.proto) are built in so they don't
+// need to be on the import path.
+func (r *Registry) Compile(importPaths []string, files ...string) ([]protoreflect.FileDescriptor, error) {
+	p := protoparse.Parser{
+		ImportPaths: importPaths,
+	}
+	fds, err := p.ParseFiles(files...)
+	if err != nil {
+		return nil, err
+	}
+	return r.Register(compiledSet(fds...))
+}
+
+// compiledSet returns a FileDescriptorSet holding fds and everything they import,
+// like protoc --include_imports would write
+func compiledSet(fds ...*desc.FileDescriptor) *descriptorpb.FileDescriptorSet {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	var add func(fd *desc.FileDescriptor)
+	add = func(fd *desc.FileDescriptor) {
+		if seen[fd.GetName()] {
+			return
+		}
+		seen[fd.GetName()] = true
+		for _, dep := range fd.GetDependencies() {
+			add(dep)
+		}
+		set.File = append(set.File, fd.AsFileDescriptorProto())
+	}
+	for _, fd := range fds {
+		add(fd)
+	}
+	return set
+}
@@ -0,0 +1,283 @@
+// Package protoset loads FileDescriptorSets, as written by
+// protoc --descriptor_set_out, so messages can be built and decoded without
+// generated code.
+//
+// A set lists its files in whatever order it was built with and may span several
+// .pb files.  Load sorts them so every file is registered after its imports, then
+// registers the message, enum and extension types (nested ones included) so
+// protojson and Any resolution find them.
+//
+// Everything is registered in a private Registry rather than
+// protoregistry.GlobalFiles and GlobalTypes, so loading a schema never conflicts
+// with generated code linked into the binary and several versions of the same
+// schema can be held side by side.
+package protoset
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	// the well-known types are linked in so sets built without
+	// --include_imports can still import them
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/apipb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/sourcecontextpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/typepb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var (
+	// ErrMissingImport is returned when a file imports one that is neither in the
+	// set nor already registered
+	ErrMissingImport = errors.New("protoset: missing import")
+	// ErrImportCycle is returned when files in the set import each other
+	ErrImportCycle = errors.New("protoset: import cycle")
+	// ErrDuplicateFile is returned when two sets contain different files with the same name
+	ErrDuplicateFile = errors.New("protoset: conflicting definitions of file")
+)
+
+// Registry holds the files and types of the loaded descriptor sets.  It
+// implements the resolver interfaces used by protojson and proto.UnmarshalOptions;
+// types it doesn't know about, such as the google.rpc error details, are looked up
+// in protoregistry.GlobalTypes.
+type Registry struct {
+	Files *protoregistry.Files
+	Types *protoregistry.Types
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		Files: &protoregistry.Files{},
+		Types: &protoregistry.Types{},
+	}
+}
+
+// Load reads and registers one or more FileDescriptorSet files.  It returns the
+// files that were registered, imports first.
+func (r *Registry) Load(paths ...string) ([]protoreflect.FileDescriptor, error) {
+	var sets []*descriptorpb.FileDescriptorSet
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		set := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(b, set); err != nil {
+			return nil, fmt.Errorf("protoset: %s is not a FileDescriptorSet: %w", p, err)
+		}
+		sets = append(sets, set)
+	}
+	return r.Register(sets...)
+}
+
+// Register adds the files in sets to r in dependency order along with their
+// types.  Files that are already in r are skipped.  Imports of the well-known
+// types that aren't in the sets are taken from the copies linked into the binary.
+func (r *Registry) Register(sets ...*descriptorpb.FileDescriptorSet) ([]protoreflect.FileDescriptor, error) {
+	ordered, err := r.sortFiles(sets)
+	if err != nil {
+		return nil, err
+	}
+
+	var fds []protoreflect.FileDescriptor
+	for _, pb := range ordered {
+		if _, err := r.Files.FindFileByPath(pb.GetName()); err == nil {
+			continue
+		}
+		fd, err := protodesc.NewFile(pb, r.Files)
+		if err != nil {
+			return nil, fmt.Errorf("protoset: %s: %w", pb.GetName(), err)
+		}
+		if err := r.Files.RegisterFile(fd); err != nil {
+			return nil, fmt.Errorf("protoset: %s: %w", pb.GetName(), err)
+		}
+		if err := r.registerTypes(fd.Messages(), fd.Enums(), fd.Extensions()); err != nil {
+			return nil, fmt.Errorf("protoset: %s: %w", pb.GetName(), err)
+		}
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
+
+// sortFiles merges the files of all sets and orders them so each file comes after
+// everything it imports.  Imports outside the sets must already be in r or be
+// one of the well-known types.
+func (r *Registry) sortFiles(sets []*descriptorpb.FileDescriptorSet) ([]*descriptorpb.FileDescriptorProto, error) {
+	byName := map[string]*descriptorpb.FileDescriptorProto{}
+	var names []string
+	for _, set := range sets {
+		for _, pb := range set.GetFile() {
+			if prev, ok := byName[pb.GetName()]; ok {
+				if !proto.Equal(prev, pb) {
+					return nil, fmt.Errorf("%w %q", ErrDuplicateFile, pb.GetName())
+				}
+				continue
+			}
+			byName[pb.GetName()] = pb
+			names = append(names, pb.GetName())
+		}
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var ordered []*descriptorpb.FileDescriptorProto
+	var visit func(name string, chain []string) error
+	visit = func(name string, chain []string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrImportCycle, strings.Join(append(chain, name), " -> "))
+		}
+		state[name] = visiting
+		pb := byName[name]
+		for _, dep := range pb.GetDependency() {
+			if _, ok := byName[dep]; !ok {
+				if err := r.importLinked(dep); err != nil {
+					return fmt.Errorf("%w: %q imports %q which is not in the descriptor set (build it with protoc --include_imports)", ErrMissingImport, name, dep)
+				}
+				continue
+			}
+			if err := visit(dep, append(chain, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		ordered = append(ordered, pb)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// importLinked makes a well-known type compiled into the binary, and its
+// imports, available to the files in r.  Its types stay in
+// protoregistry.GlobalTypes.  Other linked files, such as the google.rpc protos
+// from genproto, are not used: the set has to carry its own copy so the schema
+// it was built with is the one decoded against.
+func (r *Registry) importLinked(path string) error {
+	if _, err := r.Files.FindFileByPath(path); err == nil {
+		return nil
+	}
+	if !wellKnown(path) {
+		return protoregistry.NotFound
+	}
+	fd, err := protoregistry.GlobalFiles.FindFileByPath(path)
+	if err != nil {
+		return err
+	}
+	imports := fd.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		if err := r.importLinked(imports.Get(i).Path()); err != nil {
+			return err
+		}
+	}
+	return r.Files.RegisterFile(fd)
+}
+
+// wellKnown reports whether path is one of the google/protobuf files linked in above
+func wellKnown(path string) bool {
+	return strings.HasPrefix(path, "google/protobuf/")
+}
+
+// registerTypes adds dynamic types for the messages, enums and extensions of a
+// file, recursing into nested declarations
+func (r *Registry) registerTypes(msgs protoreflect.MessageDescriptors, enums protoreflect.EnumDescriptors, exts protoreflect.ExtensionDescriptors) error {
+	for i := 0; i < enums.Len(); i++ {
+		if err := r.Types.RegisterEnum(dynamicpb.NewEnumType(enums.Get(i))); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < exts.Len(); i++ {
+		if err := r.Types.RegisterExtension(dynamicpb.NewExtensionType(exts.Get(i))); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < msgs.Len(); i++ {
+		md := msgs.Get(i)
+		// map entries are synthetic and not registered by protoc-gen-go either
+		if md.IsMapEntry() {
+			continue
+		}
+		if err := r.Types.RegisterMessage(dynamicpb.NewMessageType(md)); err != nil {
+			return err
+		}
+		if err := r.registerTypes(md.Messages(), md.Enums(), md.Extensions()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindMethod looks up a method by its package.Service/Method (or
+// package.Service.Method) name
+func (r *Registry) FindMethod(name string) (protoreflect.MethodDescriptor, error) {
+	full := protoreflect.FullName(strings.Replace(strings.TrimPrefix(name, "/"), "/", ".", 1))
+	d, err := r.Files.FindDescriptorByName(full)
+	if err != nil {
+		return nil, err
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("protoset: %s is not a method", full)
+	}
+	return md, nil
+}
+
+// FindMessageByName implements protoregistry.MessageTypeResolver
+func (r *Registry) FindMessageByName(message protoreflect.FullName) (protoreflect.MessageType, error) {
+	mt, err := r.Types.FindMessageByName(message)
+	if err == protoregistry.NotFound {
+		return protoregistry.GlobalTypes.FindMessageByName(message)
+	}
+	return mt, err
+}
+
+// FindMessageByURL implements protoregistry.MessageTypeResolver
+func (r *Registry) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	mt, err := r.Types.FindMessageByURL(url)
+	if err == protoregistry.NotFound {
+		return protoregistry.GlobalTypes.FindMessageByURL(url)
+	}
+	return mt, err
+}
+
+// FindExtensionByName implements protoregistry.ExtensionTypeResolver
+func (r *Registry) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	xt, err := r.Types.FindExtensionByName(field)
+	if err == protoregistry.NotFound {
+		return protoregistry.GlobalTypes.FindExtensionByName(field)
+	}
+	return xt, err
+}
+
+// FindExtensionByNumber implements protoregistry.ExtensionTypeResolver
+func (r *Registry) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	xt, err := r.Types.FindExtensionByNumber(message, field)
+	if err == protoregistry.NotFound {
+		return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+	}
+	return xt, err
+}
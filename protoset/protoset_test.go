@@ -0,0 +1,150 @@
+package protoset
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// file returns a proto3 file in package test with one message, Name, and the
+// given imports
+func file(name string, msg string, deps ...string) *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:        proto.String(name),
+		Package:     proto.String("test"),
+		Syntax:      proto.String("proto3"),
+		Dependency:  deps,
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String(msg)}},
+	}
+}
+
+func TestLinkedImports(t *testing.T) {
+	tests := []struct {
+		name    string
+		dep     string
+		wantErr error
+	}{
+		{"well-known type", "google/protobuf/timestamp.proto", nil},
+		// linked into the binary by grpc's status package, but not a well-known type
+		{"other linked file", "google/rpc/status.proto", ErrMissingImport},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file("a.proto", "A", tt.dep)}}
+			_, err := NewRegistry().Register(set)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Register() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name    string
+		sets    [][]*descriptorpb.FileDescriptorProto
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "imports after the files that use them",
+			sets: [][]*descriptorpb.FileDescriptorProto{{file("a.proto", "A", "b.proto"), file("b.proto", "B", "c.proto"), file("c.proto", "C")}},
+			want: []string{"c.proto", "b.proto", "a.proto"},
+		},
+		{
+			name: "split over several sets",
+			sets: [][]*descriptorpb.FileDescriptorProto{{file("a.proto", "A", "b.proto")}, {file("b.proto", "B")}},
+			want: []string{"b.proto", "a.proto"},
+		},
+		{
+			name: "the same file in two sets",
+			sets: [][]*descriptorpb.FileDescriptorProto{{file("a.proto", "A", "b.proto"), file("b.proto", "B")}, {file("b.proto", "B")}},
+			want: []string{"b.proto", "a.proto"},
+		},
+		{
+			name:    "conflicting duplicate",
+			sets:    [][]*descriptorpb.FileDescriptorProto{{file("b.proto", "B")}, {file("b.proto", "Other")}},
+			wantErr: ErrDuplicateFile,
+		},
+		{
+			name:    "import cycle",
+			sets:    [][]*descriptorpb.FileDescriptorProto{{file("a.proto", "A", "b.proto"), file("b.proto", "B", "c.proto"), file("c.proto", "C", "a.proto")}},
+			wantErr: ErrImportCycle,
+		},
+		{
+			name:    "missing import",
+			sets:    [][]*descriptorpb.FileDescriptorProto{{file("a.proto", "A", "missing.proto")}},
+			wantErr: ErrMissingImport,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sets []*descriptorpb.FileDescriptorSet
+			for _, files := range tt.sets {
+				sets = append(sets, &descriptorpb.FileDescriptorSet{File: files})
+			}
+			fds, err := NewRegistry().Register(sets...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Register() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Register() error: %v", err)
+			}
+			var got []string
+			for _, fd := range fds {
+				got = append(got, fd.Path())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Register() returned %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterNestedTypes(t *testing.T) {
+	pb := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("nested.proto"),
+		Package: proto.String("test"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name:           proto.String("Outer"),
+			ExtensionRange: []*descriptorpb.DescriptorProto_ExtensionRange{{Start: proto.Int32(100), End: proto.Int32(200)}},
+			NestedType:     []*descriptorpb.DescriptorProto{{Name: proto.String("Inner")}},
+			EnumType: []*descriptorpb.EnumDescriptorProto{{
+				Name:  proto.String("Kind"),
+				Value: []*descriptorpb.EnumValueDescriptorProto{{Name: proto.String("KIND_UNKNOWN"), Number: proto.Int32(0)}},
+			}},
+			Extension: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("ext"),
+				Number:   proto.Int32(100),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Extendee: proto.String(".test.Outer"),
+			}},
+		}},
+	}
+	r := NewRegistry()
+	if _, err := r.Register(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{pb}}); err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+	for _, name := range []protoreflect.FullName{"test.Outer", "test.Outer.Inner"} {
+		if _, err := r.FindMessageByName(name); err != nil {
+			t.Errorf("FindMessageByName(%s) error: %v", name, err)
+		}
+	}
+	if _, err := r.Types.FindEnumByName("test.Outer.Kind"); err != nil {
+		t.Errorf("FindEnumByName(test.Outer.Kind) error: %v", err)
+	}
+	if _, err := r.FindExtensionByName("test.Outer.ext"); err != nil {
+		t.Errorf("FindExtensionByName(test.Outer.ext) error: %v", err)
+	}
+	if _, err := r.FindExtensionByNumber("test.Outer", 100); err != nil {
+		t.Errorf("FindExtensionByNumber(test.Outer, 100) error: %v", err)
+	}
+}
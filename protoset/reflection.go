@@ -0,0 +1,181 @@
+package protoset
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"main/wireformat"
+)
+
+// the v1 and v1alpha reflection services use identical messages so the v1alpha
+// generated types are used for both
+var reflectionMethods = []string{
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// LoadReflection downloads the files that define symbol (normally a
+// package.Service name), and everything they import, from the server's
+// reflection service and registers them.  v1 of the service is tried first,
+// falling back to v1alpha for servers that only have that.
+//
+// The call is made over the ServerReflectionInfo bidi stream at baseURL using do,
+// which sends the request (eg http.Client.Do after setting :authority and any
+// metadata).
+func (r *Registry) LoadReflection(ctx context.Context, do func(*http.Request) (*http.Response, error), baseURL, symbol string) ([]protoreflect.FileDescriptor, error) {
+	var err error
+	for _, m := range reflectionMethods {
+		var files []*descriptorpb.FileDescriptorProto
+		files, err = fetchFiles(ctx, do, strings.TrimSuffix(baseURL, "/")+m, symbol)
+		if status.Code(err) == codes.Unimplemented {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return r.Register(&descriptorpb.FileDescriptorSet{File: files})
+	}
+	return nil, err
+}
+
+// fetchFiles asks for the file containing symbol and then, one request at a
+// time on the same stream, for any imports the server didn't already send.
+// Imports linked into the binary aren't requested.
+func fetchFiles(ctx context.Context, do func(*http.Request) (*http.Response, error), url, symbol string) ([]*descriptorpb.FileDescriptorProto, error) {
+	stream := wireformat.NewRequestStream()
+	req, err := wireformat.NewRequest(ctx, url, stream)
+	if err != nil {
+		return nil, err
+	}
+	// servers only send response headers once they have something to say so the
+	// first request has to go out while do waits for them
+	next := &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	}
+	first := next
+	sent := make(chan error, 1)
+	go func() {
+		sent <- sendReflection(stream, first)
+	}()
+	resp, err := do(req)
+	if err != nil {
+		stream.CloseWithError(err)
+		return nil, wireformat.ContextError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if err := wireformat.CheckResponse(resp); err != nil {
+		stream.CloseWithError(err)
+		return nil, err
+	}
+	// a server without the service answers straight away with a Trailers-Only response
+	if resp.Header.Get("grpc-status") != "" {
+		stream.CloseWithError(io.EOF)
+		return nil, wireformat.Status(resp.Header, resp.Trailer).Err()
+	}
+	dec := wireformat.NewDecoder(resp.Body)
+	if err := dec.SetEncoding(resp.Header.Get("grpc-encoding")); err != nil {
+		stream.CloseWithError(err)
+		return nil, err
+	}
+
+	var files []*descriptorpb.FileDescriptorProto
+	have := map[string]bool{}
+	var pending []string
+	for next != nil {
+		if err := <-sent; err != nil {
+			stream.CloseWithError(err)
+			return nil, wireformat.ContextError(ctx, err)
+		}
+		res, err := recvReflection(dec)
+		if err == io.EOF {
+			// the server ended the stream; the trailers say why
+			err = wireformat.Status(resp.Header, resp.Trailer).Err()
+			if err == nil {
+				err = status.Error(codes.Internal, "protoset: reflection stream ended without a response")
+			}
+		}
+		if err != nil {
+			stream.CloseWithError(err)
+			return nil, wireformat.ContextError(ctx, err)
+		}
+		if e := res.GetErrorResponse(); e != nil {
+			stream.CloseWithError(io.EOF)
+			return nil, status.Errorf(codes.Code(e.GetErrorCode()), "protoset: reflection request {%v} failed: %s", next, e.GetErrorMessage())
+		}
+		for _, b := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			pb := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, pb); err != nil {
+				stream.CloseWithError(err)
+				return nil, fmt.Errorf("protoset: reflection returned a malformed file descriptor: %w", err)
+			}
+			if have[pb.GetName()] {
+				continue
+			}
+			have[pb.GetName()] = true
+			files = append(files, pb)
+			pending = append(pending, pb.GetDependency()...)
+		}
+
+		// the server usually sends the imports along with the file; ask for any it didn't
+		next = nil
+		for len(pending) > 0 && next == nil {
+			dep := pending[0]
+			pending = pending[1:]
+			if have[dep] {
+				continue
+			}
+			if _, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil && wellKnown(dep) {
+				continue
+			}
+			next = &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+			}
+			sent <- sendReflection(stream, next)
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	// read to EOF so the trailers are populated
+	if err := dec.Receive(func([]byte) error { return nil }); err != nil {
+		return nil, wireformat.ContextError(ctx, err)
+	}
+	if err := wireformat.Status(resp.Header, resp.Trailer).Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// sendReflection writes one request to the stream
+func sendReflection(stream *wireformat.RequestStream, req *rpb.ServerReflectionRequest) error {
+	b, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return stream.Send(b)
+}
+
+// recvReflection reads the next response off the stream
+func recvReflection(dec *wireformat.Decoder) (*rpb.ServerReflectionResponse, error) {
+	msg, err := dec.DecodeMessage()
+	if err != nil {
+		return nil, err
+	}
+	res := &rpb.ServerReflectionResponse{}
+	if err := proto.Unmarshal(msg, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,191 @@
+package rawproto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// explainBytesPerLine is how many bytes Line shows on each line before wrapping
+const explainBytesPerLine = 8
+
+// Explainer writes an annotated hex dump, one line per tag, length and value,
+// with the offset of each
+type Explainer struct {
+	w   io.Writer
+	err error
+}
+
+// NewExplainer returns an Explainer that writes to w
+func NewExplainer(w io.Writer) *Explainer {
+	return &Explainer{w: w}
+}
+
+// Line writes b, which starts at offset, with a description.  Depth indents the
+// description to show nesting.  Long byte runs wrap onto further lines.
+func (e *Explainer) Line(offset int, b []byte, depth int, format string, args ...interface{}) {
+	text := strings.Repeat("  ", depth) + fmt.Sprintf(format, args...)
+	for first := true; first || len(b) > 0; first = false {
+		n := len(b)
+		if n > explainBytesPerLine {
+			n = explainBytesPerLine
+		}
+		var hb strings.Builder
+		for i, c := range b[:n] {
+			if i > 0 {
+				hb.WriteByte(' ')
+			}
+			hb.WriteString(hex.EncodeToString([]byte{c}))
+		}
+		if e.err == nil {
+			line := fmt.Sprintf("%06x  %-*s  %s", offset, explainBytesPerLine*3-1, hb.String(), text)
+			_, e.err = fmt.Fprintln(e.w, strings.TrimRight(line, " "))
+		}
+		offset += n
+		b = b[n:]
+		text = ""
+	}
+}
+
+// Err returns the first error writing the output
+func (e *Explainer) Err() error {
+	return e.err
+}
+
+// Message explains every byte of the serialized message b, which starts at
+// offset in the output.  md, if not nil, supplies field names and how to read the
+// values; unknown fields and nested messages without a descriptor fall back to
+// the guesses Parse makes.
+func (e *Explainer) Message(b []byte, offset int, depth int, md protoreflect.MessageDescriptor) error {
+	fields, err := Parse(b)
+	if err != nil {
+		return err
+	}
+	e.fields(b, fields, offset, depth, md)
+	return e.err
+}
+
+// fields explains fields parsed from buf, which starts at base in the output
+func (e *Explainer) fields(buf []byte, fields []Field, base int, depth int, md protoreflect.MessageDescriptor) {
+	for i := range fields {
+		f := &fields[i]
+		var fd protoreflect.FieldDescriptor
+		name := ""
+		if md != nil {
+			fd = md.Fields().ByNumber(f.Number)
+			if fd == nil {
+				name = " (unknown field)"
+			} else {
+				name = " (" + string(fd.Name()) + ")"
+			}
+		}
+
+		e.Line(base+f.Offset, buf[f.Offset:f.Offset+f.TagLen], depth, "tag: field %d%s, wire type %d (%s)", f.Number, name, f.Type, WireTypeName(f.Type))
+		valueAt := f.ValueOffset()
+		if f.Type == protowire.BytesType {
+			e.Line(base+f.Offset+f.TagLen, buf[f.Offset+f.TagLen:valueAt], depth, "length: %d", len(f.Value))
+		}
+
+		nested := f.Message
+		if fd != nil && fd.Message() != nil {
+			// the schema says this is a message even if it looked like text
+			if f.Type == protowire.BytesType && (nested == nil || f.String) {
+				if m, err := f.ParseMessage(); err == nil {
+					nested = m
+				}
+			}
+		} else if fd != nil {
+			nested = nil
+		}
+
+		switch {
+		case f.Type == protowire.StartGroupType:
+			// the fields of a group are always there to explain, whatever the
+			// schema thinks the field is
+			var child protoreflect.MessageDescriptor
+			if fd != nil {
+				child = fd.Message()
+			}
+			e.fields(buf, f.Message, base, depth+1, child)
+			end := f.Offset + f.Len
+			e.Line(base+end-protowire.SizeTag(f.Number), buf[end-protowire.SizeTag(f.Number):end], depth, "end group: field %d", f.Number)
+		case nested != nil && (fd != nil || !f.String):
+			var child protoreflect.MessageDescriptor
+			if fd != nil {
+				child = fd.Message()
+			}
+			e.fields(buf, nested, base, depth+1, child)
+		default:
+			e.Line(base+valueAt, f.Value, depth, "value: %s", valueString(f, fd))
+		}
+	}
+}
+
+// valueString reads a scalar value the way the field's kind says to or, without
+// a descriptor, every way it could be read
+func valueString(f *Field, fd protoreflect.FieldDescriptor) string {
+	if fd == nil {
+		return f.Interpret()
+	}
+	switch f.Type {
+	case protowire.VarintType:
+		v, _ := protowire.ConsumeVarint(f.Value)
+		switch fd.Kind() {
+		case protoreflect.BoolKind:
+			return strconv.FormatBool(protowire.DecodeBool(v))
+		case protoreflect.EnumKind:
+			if ev := fd.Enum().Values().ByNumber(protoreflect.EnumNumber(v)); ev != nil {
+				return fmt.Sprintf("%s (%d)", ev.Name(), int32(v))
+			}
+			return strconv.FormatInt(int64(int32(v)), 10)
+		case protoreflect.Int32Kind:
+			return strconv.FormatInt(int64(int32(v)), 10)
+		case protoreflect.Int64Kind:
+			return strconv.FormatInt(int64(v), 10)
+		case protoreflect.Uint32Kind, protoreflect.Uint64Kind:
+			return strconv.FormatUint(v, 10)
+		case protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+			return strconv.FormatInt(protowire.DecodeZigZag(v), 10)
+		}
+	case protowire.Fixed32Type:
+		v, _ := protowire.ConsumeFixed32(f.Value)
+		switch fd.Kind() {
+		case protoreflect.Fixed32Kind:
+			return strconv.FormatUint(uint64(v), 10)
+		case protoreflect.Sfixed32Kind:
+			return strconv.FormatInt(int64(int32(v)), 10)
+		case protoreflect.FloatKind:
+			return fmt.Sprint(math.Float32frombits(v))
+		}
+	case protowire.Fixed64Type:
+		v, _ := protowire.ConsumeFixed64(f.Value)
+		switch fd.Kind() {
+		case protoreflect.Fixed64Kind:
+			return strconv.FormatUint(v, 10)
+		case protoreflect.Sfixed64Kind:
+			return strconv.FormatInt(int64(v), 10)
+		case protoreflect.DoubleKind:
+			return fmt.Sprint(math.Float64frombits(v))
+		}
+	case protowire.BytesType:
+		switch {
+		case fd.Kind() == protoreflect.StringKind:
+			return strconv.Quote(string(f.Value))
+		case fd.Kind() == protoreflect.BytesKind:
+			return hex.EncodeToString(f.Value)
+		case fd.Message() != nil && len(f.Value) == 0:
+			return "empty " + string(fd.Message().FullName())
+		case fd.Message() != nil:
+			return fmt.Sprintf("%s (does not parse as %s)", hex.EncodeToString(f.Value), fd.Message().FullName())
+		case fd.IsList():
+			return fmt.Sprintf("packed %s %s", fd.Kind(), hex.EncodeToString(f.Value))
+		}
+	}
+	return f.Interpret() + fmt.Sprintf(" (wire type does not match %s field)", fd.Kind())
+}
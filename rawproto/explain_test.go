@@ -0,0 +1,39 @@
+package rawproto
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// explainedBytes counts the bytes shown in the hex column of Explainer output
+func explainedBytes(out string) int {
+	n := 0
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		col := line[8:]
+		if len(col) > explainBytesPerLine*3-1 {
+			col = col[:explainBytesPerLine*3-1]
+		}
+		n += len(strings.Fields(col))
+	}
+	return n
+}
+
+func TestExplainGroupSchemaMismatch(t *testing.T) {
+	// group 1 { field 2: varint 5 }, where google.protobuf.Duration has the int64
+	// seconds as field 1
+	msg := []byte{0x0b, 0x10, 0x05, 0x0c}
+	var sb strings.Builder
+	md := (&durationpb.Duration{}).ProtoReflect().Descriptor()
+	if err := NewExplainer(&sb).Message(msg, 0, 0, md); err != nil {
+		t.Fatalf("Message() error: %v", err)
+	}
+	out := sb.String()
+	if got := explainedBytes(out); got != len(msg) {
+		t.Errorf("explained %d of %d bytes:\n%s", got, len(msg), out)
+	}
+	if !strings.Contains(out, "tag: field 2") {
+		t.Errorf("the field inside the group is missing:\n%s", out)
+	}
+}
@@ -0,0 +1,254 @@
+// Package rawproto decodes serialized protobuf messages without a schema, the
+// same way protoc --decode_raw does.
+//
+// Only the field numbers and wire types are on the wire so the values are shown
+// every way they could have been encoded: a varint could be an int, a bool or a
+// zigzag encoded sint; fixed32 and fixed64 could be integers or floats; and a
+// length-delimited field could be a string, bytes, packed numbers or a nested
+// message.  Parse guesses which by trying to decode it as a message.
+package rawproto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// recursionLimit is how deeply groups and messages may nest, the same limit
+// protobuf-go applies.  Parsing recurses once per level so without it a few MB
+// of start group tags overflow the stack.
+const recursionLimit = 10000
+
+// Field is one field of a serialized message
+type Field struct {
+	Number protowire.Number
+	Type   protowire.Type
+	// Offset is where the tag starts in the buffer given to Parse
+	Offset int
+	// TagLen is the size of the tag; the length prefix (LenLen bytes, only for
+	// length-delimited fields) and then the value follow it
+	TagLen int
+	LenLen int
+	// Len is the size of the whole field including the tag and, for groups, the end tag
+	Len int
+	// Value is the encoded varint, the 4 or 8 fixed bytes, the contents of a
+	// length-delimited field or everything between the start and end tags of a group
+	Value []byte
+	// Message holds the fields of a group or of a length-delimited value that
+	// parsed as a message
+	Message []Field
+	// String is true if a length-delimited value is printable text; it is
+	// shown as a string rather than a nested message
+	String bool
+	// depth is how many groups and messages the field is nested in
+	depth int
+}
+
+// ValueOffset is where the value starts in the buffer given to Parse
+func (f *Field) ValueOffset() int {
+	return f.Offset + f.TagLen + f.LenLen
+}
+
+// Parse decodes every field in b.  Length-delimited values that are printable
+// text are kept as strings; otherwise they are parsed as a nested message if
+// that consumes them exactly and isn't nested too deeply.
+func Parse(b []byte) ([]Field, error) {
+	fields, _, err := parse(b, 0, 0, 0)
+	return fields, err
+}
+
+// ParseMessage decodes the value of a length-delimited field as a message
+// regardless of what Parse guessed it was.  Offsets stay relative to the buffer
+// given to Parse.
+func (f *Field) ParseMessage() ([]Field, error) {
+	if f.depth >= recursionLimit {
+		return nil, fmt.Errorf("rawproto: field %d at offset %d: message nested too deeply", f.Number, f.Offset)
+	}
+	fields, _, err := parse(f.Value, f.ValueOffset(), 0, f.depth+1)
+	return fields, err
+}
+
+// parse decodes the fields in b, whose first byte is at offset base in the
+// original buffer and which is nested depth levels deep.  With group set it
+// stops after that group's end tag and returns how many bytes were read.
+func parse(b []byte, base int, group protowire.Number, depth int) ([]Field, int, error) {
+	var fields []Field
+	pos := 0
+	for pos < len(b) {
+		num, typ, n := protowire.ConsumeTag(b[pos:])
+		if n < 0 {
+			return nil, 0, fmt.Errorf("rawproto: tag at offset %d: %w", base+pos, protowire.ParseError(n))
+		}
+		f := Field{Number: num, Type: typ, Offset: base + pos, TagLen: n, depth: depth}
+		rest := b[pos+n:]
+		switch typ {
+		case protowire.VarintType:
+			_, n = protowire.ConsumeVarint(rest)
+		case protowire.Fixed32Type:
+			_, n = protowire.ConsumeFixed32(rest)
+		case protowire.Fixed64Type:
+			_, n = protowire.ConsumeFixed64(rest)
+		case protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(rest)
+			if n >= 0 {
+				f.LenLen = n - len(v)
+				rest = v
+				n = len(v)
+			}
+		case protowire.StartGroupType:
+			if depth >= recursionLimit {
+				return nil, 0, fmt.Errorf("rawproto: group %d at offset %d is nested too deeply", num, base+pos)
+			}
+			var read int
+			var err error
+			f.Message, read, err = parse(rest, f.Offset+f.TagLen, num, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			f.Value = rest[:read-protowire.SizeTag(num)]
+			f.Len = f.TagLen + read
+			fields = append(fields, f)
+			pos += f.Len
+			continue
+		case protowire.EndGroupType:
+			if num != group {
+				return nil, 0, fmt.Errorf("rawproto: unexpected end of group %d at offset %d", num, base+pos)
+			}
+			return fields, pos + n, nil
+		default:
+			// wire types 6 and 7 are reserved
+			return nil, 0, fmt.Errorf("rawproto: field %d at offset %d: %w", num, base+pos, protowire.ParseError(-4))
+		}
+		if n < 0 {
+			return nil, 0, fmt.Errorf("rawproto: field %d at offset %d: %w", num, base+pos, protowire.ParseError(n))
+		}
+		f.Value = rest[:n]
+		f.Len = f.TagLen + f.LenLen + n
+		if typ == protowire.BytesType {
+			if isText(f.Value) {
+				f.String = true
+			} else if depth < recursionLimit {
+				// past the limit the value is left as bytes
+				if m, _, err := parse(f.Value, f.ValueOffset(), 0, depth+1); err == nil {
+					f.Message = m
+				}
+			}
+		}
+		fields = append(fields, f)
+		pos += f.Len
+	}
+	if group != 0 {
+		return nil, 0, fmt.Errorf("rawproto: group %d is missing its end tag", group)
+	}
+	return fields, pos, nil
+}
+
+// isText is true for valid UTF-8 with no control characters other than
+// whitespace.  The empty value counts as text.
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// WireTypeName returns the name of a wire type as used in the protobuf encoding docs
+func WireTypeName(t protowire.Type) string {
+	switch t {
+	case protowire.VarintType:
+		return "varint"
+	case protowire.Fixed32Type:
+		return "fixed32"
+	case protowire.Fixed64Type:
+		return "fixed64"
+	case protowire.BytesType:
+		return "bytes"
+	case protowire.StartGroupType:
+		return "group"
+	case protowire.EndGroupType:
+		return "end group"
+	default:
+		return "wire type " + strconv.Itoa(int(t))
+	}
+}
+
+// Interpret describes a scalar value every way it could be read: a varint as
+// unsigned, signed and zigzag, fixed values as integers and floats, and
+// length-delimited values as a quoted string or hex.  Nested messages are
+// described by their length only.
+func (f *Field) Interpret() string {
+	switch f.Type {
+	case protowire.VarintType:
+		v, _ := protowire.ConsumeVarint(f.Value)
+		s := strconv.FormatUint(v, 10)
+		var alt []string
+		if int64(v) < 0 {
+			alt = append(alt, "int64 "+strconv.FormatInt(int64(v), 10))
+		}
+		if z := protowire.DecodeZigZag(v); z != int64(v) {
+			alt = append(alt, "sint "+strconv.FormatInt(z, 10))
+		}
+		if len(alt) > 0 {
+			s += " (" + strings.Join(alt, ", ") + ")"
+		}
+		return s
+	case protowire.Fixed32Type:
+		v, _ := protowire.ConsumeFixed32(f.Value)
+		return fmt.Sprintf("0x%08x (uint32 %d, int32 %d, float %v)", v, v, int32(v), math.Float32frombits(v))
+	case protowire.Fixed64Type:
+		v, _ := protowire.ConsumeFixed64(f.Value)
+		return fmt.Sprintf("0x%016x (uint64 %d, int64 %d, double %v)", v, v, int64(v), math.Float64frombits(v))
+	case protowire.BytesType:
+		if f.String {
+			return strconv.Quote(string(f.Value))
+		}
+		if f.Message != nil {
+			return fmt.Sprintf("message (%d bytes)", len(f.Value))
+		}
+		return fmt.Sprintf("%s (%d bytes)", hex.EncodeToString(f.Value), len(f.Value))
+	case protowire.StartGroupType:
+		return fmt.Sprintf("group (%d bytes)", len(f.Value))
+	}
+	return ""
+}
+
+// Format writes fields in the indented text form of protoc --decode_raw, with
+// the wire type and every reading of each value
+func Format(w io.Writer, fields []Field) error {
+	return format(w, fields, "")
+}
+
+func format(w io.Writer, fields []Field, indent string) error {
+	for i := range fields {
+		f := &fields[i]
+		var err error
+		if f.Message != nil && !f.String || f.Type == protowire.StartGroupType {
+			_, err = fmt.Fprintf(w, "%s%d: %s {\n", indent, f.Number, WireTypeName(f.Type))
+			if err == nil {
+				err = format(w, f.Message, indent+"  ")
+			}
+			if err == nil {
+				_, err = fmt.Fprintf(w, "%s}\n", indent)
+			}
+		} else {
+			_, err = fmt.Fprintf(w, "%s%d: %s %s\n", indent, f.Number, WireTypeName(f.Type), f.Interpret())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package wireformat
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Compressor implements one grpc-encoding for per-message compression
+type Compressor interface {
+	// Name is the value sent in the grpc-encoding header
+	Name() string
+	// Compress returns a writer that compresses into w
+	Compress(w io.Writer) (io.WriteCloser, error)
+	// Decompress returns a reader that decompresses r
+	Decompress(r io.Reader) (io.Reader, error)
+}
+
+var (
+	// Identity is the "identity" grpc-encoding; messages are sent with the compressed flag unset
+	Identity Compressor = identityCompressor{}
+	// Gzip is the "gzip" grpc-encoding
+	Gzip Compressor = gzipCompressor{}
+	// Deflate is the "deflate" grpc-encoding
+	Deflate Compressor = deflateCompressor{}
+	// Snappy is the "snappy" grpc-encoding (framed snappy stream)
+	Snappy Compressor = snappyCompressor{}
+	// Zstd is the "zstd" grpc-encoding
+	Zstd Compressor = zstdCompressor{}
+)
+
+var (
+	registryMu  sync.RWMutex
+	compressors = map[string]Compressor{}
+)
+
+func init() {
+	for _, c := range []Compressor{Identity, Gzip, Deflate, Snappy, Zstd} {
+		RegisterCompressor(c)
+	}
+}
+
+// RegisterCompressor makes c available under c.Name() to GetCompressor,
+// replacing any compressor previously registered with that name
+func RegisterCompressor(c Compressor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	compressors[c.Name()] = c
+}
+
+// GetCompressor returns the compressor registered for a grpc-encoding name.
+// Unknown names fail with codes.Unimplemented, the same as grpc-go.
+func GetCompressor(name string) (Compressor, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	c, ok := compressors[name]
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "grpc: Decompressor is not installed for grpc-encoding %q", name)
+	}
+	return c, nil
+}
+
+// RegisteredCompressors returns the sorted names of all registered compressors
+// in the comma separated form used by grpc-accept-encoding
+func RegisteredCompressors() string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(compressors))
+	for n := range compressors {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// isIdentity is true for compressors that leave the compressed flag unset
+func isIdentity(c Compressor) bool {
+	return c == nil || c.Name() == Identity.Name()
+}
+
+type identityCompressor struct{}
+
+func (identityCompressor) Name() string {
+	return "identity"
+}
+
+func (identityCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (identityCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return r, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (gzipCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+type deflateCompressor struct{}
+
+func (deflateCompressor) Name() string {
+	return "deflate"
+}
+
+func (deflateCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, flate.DefaultCompression)
+}
+
+func (deflateCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return flate.NewReader(r), nil
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Name() string {
+	return "snappy"
+}
+
+func (snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return snappy.NewReader(r), nil
+}
+
+type zstdCompressor struct{}
+
+func (zstdCompressor) Name() string {
+	return "zstd"
+}
+
+func (zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+func (zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+func compress(c Compressor, in []byte) ([]byte, error) {
+	var out bytes.Buffer
+	w, err := c.Compress(&out)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(in); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// decompress inflates in, reading at most max+1 bytes so a small frame can't
+// expand past the message size limit
+func decompress(c Compressor, in []byte, max int) ([]byte, error) {
+	r, err := c.Decompress(bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	if rc, ok := r.(io.Closer); ok {
+		defer rc.Close()
+	}
+	return io.ReadAll(io.LimitReader(r, int64(max)+1))
+}
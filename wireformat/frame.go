@@ -0,0 +1,258 @@
+// Package wireformat implements the gRPC Length-Prefixed-Message framing
+// described in https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+//
+//	Length-Prefixed-Message → Compressed-Flag Message-Length Message
+//	Compressed-Flag → 0 / 1   # encoded as 1 byte unsigned integer
+//	Message-Length → {length of Message}   # encoded as 4 byte unsigned integer (big endian)
+//	Message → *{binary octet}
+package wireformat
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// HeaderLen is the size of the prefix in front of every message: 1 byte
+	// compressed flag followed by a 4 byte big-endian length
+	HeaderLen = 5
+
+	// DefaultMaxMessageSize is the default limit on the payload size of a single
+	// frame, the same 4MiB grpc-go uses for received messages
+	DefaultMaxMessageSize = 4 * 1024 * 1024
+
+	flagUncompressed byte = 0
+	flagCompressed   byte = 1
+)
+
+var (
+	// ErrTruncatedHeader is returned when the stream ends part way through the 5 byte prefix
+	ErrTruncatedHeader = errors.New("wireformat: truncated frame header")
+	// ErrShortPayload is returned when the stream ends before Message-Length bytes were read
+	ErrShortPayload = errors.New("wireformat: frame payload shorter than declared length")
+	// ErrInvalidFlag is returned when the Compressed-Flag byte is neither 0 nor 1
+	ErrInvalidFlag = errors.New("wireformat: invalid compressed flag")
+)
+
+// Frame is a single gRPC Length-Prefixed-Message
+type Frame struct {
+	// Compressed is true if Payload was compressed using the grpc-encoding of the stream
+	Compressed bool
+	// Payload is the (possibly compressed) serialized protobuf message
+	Payload []byte
+}
+
+// Header returns the 5 byte prefix for this frame
+func (f *Frame) Header() [HeaderLen]byte {
+	var h [HeaderLen]byte
+	if f.Compressed {
+		h[0] = flagCompressed
+	}
+	binary.BigEndian.PutUint32(h[1:], uint32(len(f.Payload)))
+	return h
+}
+
+// Bytes returns the frame as it would appear on the wire
+func (f *Frame) Bytes() []byte {
+	h := f.Header()
+	return append(h[:], f.Payload...)
+}
+
+// Encoder writes frames to an io.Writer
+type Encoder struct {
+	w          io.Writer
+	maxSize    int
+	compressor Compressor
+}
+
+// NewEncoder returns an Encoder that writes to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, maxSize: DefaultMaxMessageSize}
+}
+
+// SetMaxMessageSize sets the largest payload Encode will write
+func (e *Encoder) SetMaxMessageSize(n int) {
+	e.maxSize = n
+}
+
+// SetCompressor sets the compressor EncodeMessage uses.  nil sends messages uncompressed.
+func (e *Encoder) SetCompressor(c Compressor) {
+	e.compressor = c
+}
+
+// SetEncoding looks up a grpc-encoding name in the compressor registry and
+// uses it for EncodeMessage
+func (e *Encoder) SetEncoding(name string) error {
+	c, err := GetCompressor(name)
+	if err != nil {
+		return err
+	}
+	e.compressor = c
+	return nil
+}
+
+// EncodeMessage frames a serialized message, compressing it and setting the
+// compressed flag if a compressor was set
+func (e *Encoder) EncodeMessage(msg []byte) error {
+	if len(msg) > e.maxSize {
+		return status.Errorf(codes.ResourceExhausted, "grpc: trying to send message larger than max (%d vs. %d)", len(msg), e.maxSize)
+	}
+	if isIdentity(e.compressor) {
+		return e.Encode(&Frame{Payload: msg})
+	}
+	payload, err := compress(e.compressor, msg)
+	if err != nil {
+		return status.Errorf(codes.Internal, "grpc: error while compressing: %v", err)
+	}
+	return e.Encode(&Frame{Compressed: true, Payload: payload})
+}
+
+// Encode writes the prefix and payload of f.  Payloads larger than the
+// maximum message size fail with codes.ResourceExhausted before anything is written.
+func (e *Encoder) Encode(f *Frame) error {
+	if len(f.Payload) > e.maxSize {
+		return status.Errorf(codes.ResourceExhausted, "grpc: trying to send message larger than max (%d vs. %d)", len(f.Payload), e.maxSize)
+	}
+	h := f.Header()
+	if _, err := e.w.Write(h[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(f.Payload)
+	return err
+}
+
+// Decoder reads frames from an io.Reader
+type Decoder struct {
+	r            io.Reader
+	maxSize      int
+	maxInflated  int
+	decompressor Compressor
+}
+
+// NewDecoder returns a Decoder that reads from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, maxSize: DefaultMaxMessageSize}
+}
+
+// SetMaxMessageSize sets the largest payload Decode will accept.  Unless
+// SetMaxDecompressedSize is called it also limits decompressed messages.
+func (d *Decoder) SetMaxMessageSize(n int) {
+	d.maxSize = n
+}
+
+// SetMaxDecompressedSize sets the largest message DecodeMessage will inflate a
+// compressed frame to, separately from the limit on the frame itself
+func (d *Decoder) SetMaxDecompressedSize(n int) {
+	d.maxInflated = n
+}
+
+// SetDecompressor sets the compressor DecodeMessage uses for frames with the
+// compressed flag set, normally chosen by the grpc-encoding response header
+func (d *Decoder) SetDecompressor(c Compressor) {
+	d.decompressor = c
+}
+
+// SetEncoding looks up the grpc-encoding of the stream in the compressor
+// registry.  An empty name means identity.
+func (d *Decoder) SetEncoding(name string) error {
+	if name == "" {
+		d.decompressor = nil
+		return nil
+	}
+	c, err := GetCompressor(name)
+	if err != nil {
+		return err
+	}
+	d.decompressor = c
+	return nil
+}
+
+// DecodeMessage reads the next frame and returns its serialized message,
+// decompressing it if the compressed flag is set
+func (d *Decoder) DecodeMessage() ([]byte, error) {
+	f, err := d.Decode()
+	if err != nil {
+		return nil, err
+	}
+	if !f.Compressed {
+		return f.Payload, nil
+	}
+	if isIdentity(d.decompressor) {
+		return nil, status.Errorf(codes.Internal, "grpc: compressed flag set with identity or empty encoding")
+	}
+	max := d.maxSize
+	if d.maxInflated > 0 {
+		max = d.maxInflated
+	}
+	msg, err := decompress(d.decompressor, f.Payload, max)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "grpc: failed to decompress the received message: %v", err)
+	}
+	if len(msg) > max {
+		return nil, status.Errorf(codes.ResourceExhausted, "grpc: received message after decompression larger than max (%d vs. %d)", len(msg), max)
+	}
+	return msg, nil
+}
+
+// Receive calls fn with each message as its frame arrives until the stream ends
+// cleanly on a frame boundary.  For a response body that is also when the
+// trailers become available.
+func (d *Decoder) Receive(fn func(msg []byte) error) error {
+	for {
+		msg, err := d.DecodeMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// Decode reads the next frame.  It returns io.EOF only if the stream ends
+// cleanly on a frame boundary.  A declared length over the maximum message size
+// fails with codes.ResourceExhausted before the payload is allocated.
+func (d *Decoder) Decode() (*Frame, error) {
+	var h [HeaderLen]byte
+	n, err := io.ReadFull(d.r, h[:])
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: got %d of %d bytes", ErrTruncatedHeader, n, HeaderLen)
+		}
+		return nil, err
+	}
+
+	f := &Frame{}
+	switch h[0] {
+	case flagUncompressed:
+	case flagCompressed:
+		f.Compressed = true
+	default:
+		return nil, fmt.Errorf("%w: 0x%02x", ErrInvalidFlag, h[0])
+	}
+
+	length := binary.BigEndian.Uint32(h[1:])
+	if uint64(length) > uint64(d.maxSize) {
+		return nil, status.Errorf(codes.ResourceExhausted, "grpc: received message larger than max (%d vs. %d)", length, d.maxSize)
+	}
+	f.Payload = make([]byte, length)
+	n, err = io.ReadFull(d.r, f.Payload)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: got %d of %d bytes", ErrShortPayload, n, length)
+		}
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,155 @@
+package wireformat
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []byte
+		want    *Frame
+		wantErr error
+		code    codes.Code
+	}{
+		{name: "empty stream", in: nil, wantErr: io.EOF},
+		{name: "uncompressed", in: []byte{0, 0, 0, 0, 2, 0x08, 0x01}, want: &Frame{Payload: []byte{0x08, 0x01}}},
+		{name: "compressed", in: []byte{1, 0, 0, 0, 1, 0xff}, want: &Frame{Compressed: true, Payload: []byte{0xff}}},
+		{name: "empty message", in: []byte{0, 0, 0, 0, 0}, want: &Frame{Payload: []byte{}}},
+		{name: "truncated header", in: []byte{0, 0, 0}, wantErr: ErrTruncatedHeader},
+		{name: "short payload", in: []byte{0, 0, 0, 0, 4, 0x08, 0x01}, wantErr: ErrShortPayload},
+		{name: "missing payload", in: []byte{0, 0, 0, 0, 4}, wantErr: ErrShortPayload},
+		{name: "invalid flag", in: []byte{2, 0, 0, 0, 0}, wantErr: ErrInvalidFlag},
+		{name: "over max size", in: []byte{0, 0xff, 0xff, 0xff, 0xff}, code: codes.ResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewDecoder(bytes.NewReader(tt.in)).Decode()
+			switch {
+			case tt.code != codes.OK:
+				if status.Code(err) != tt.code {
+					t.Fatalf("Decode() error = %v, want code %v", err, tt.code)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("Decode() error: %v", err)
+			default:
+				if f.Compressed != tt.want.Compressed || !bytes.Equal(f.Payload, tt.want.Payload) {
+					t.Errorf("Decode() = %+v, want %+v", f, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// headerOnly returns the header and then fails the test if anything more is read
+type headerOnly struct {
+	t *testing.T
+	r io.Reader
+}
+
+func (h *headerOnly) Read(b []byte) (int, error) {
+	n, err := h.r.Read(b)
+	if err == io.EOF {
+		h.t.Errorf("Decode() read past the header")
+	}
+	return n, err
+}
+
+func TestDecodeMaxSize(t *testing.T) {
+	// declares a 1GiB message
+	d := NewDecoder(&headerOnly{t: t, r: bytes.NewReader([]byte{0, 0x40, 0, 0, 0})})
+	d.SetMaxMessageSize(4096)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := d.Decode()
+	runtime.ReadMemStats(&after)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Decode() error = %v, want ResourceExhausted", err)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("Decode() allocated %d bytes for an oversized message", n)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetMaxMessageSize(4)
+	if err := e.EncodeMessage(make([]byte, 5)); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("EncodeMessage() error = %v, want ResourceExhausted", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("EncodeMessage() wrote %d bytes of an oversized message", buf.Len())
+	}
+}
+
+func TestCompressedRoundTrip(t *testing.T) {
+	msg := []byte(strings.Repeat("hello sal a mander ", 100))
+	for _, name := range strings.Split(RegisteredCompressors(), ",") {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			e := NewEncoder(&buf)
+			if err := e.SetEncoding(name); err != nil {
+				t.Fatalf("SetEncoding(%q) error: %v", name, err)
+			}
+			if err := e.EncodeMessage(msg); err != nil {
+				t.Fatalf("EncodeMessage() error: %v", err)
+			}
+			if compressed := buf.Bytes()[0] == flagCompressed; compressed != (name != "identity") {
+				t.Errorf("compressed flag = %v for %s", compressed, name)
+			}
+
+			d := NewDecoder(&buf)
+			if err := d.SetEncoding(name); err != nil {
+				t.Fatalf("SetEncoding(%q) error: %v", name, err)
+			}
+			got, err := d.DecodeMessage()
+			if err != nil {
+				t.Fatalf("DecodeMessage() error: %v", err)
+			}
+			if !bytes.Equal(got, msg) {
+				t.Errorf("DecodeMessage() = %q, want %q", got, msg)
+			}
+		})
+	}
+}
+
+func TestMaxDecompressedSize(t *testing.T) {
+	msg := make([]byte, 1000)
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetCompressor(Gzip)
+	if err := e.EncodeMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+
+	d := NewDecoder(bytes.NewReader(frame))
+	d.SetDecompressor(Gzip)
+	d.SetMaxMessageSize(len(frame))
+	if _, err := d.DecodeMessage(); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("DecodeMessage() error = %v, want ResourceExhausted", err)
+	}
+
+	d = NewDecoder(bytes.NewReader(frame))
+	d.SetDecompressor(Gzip)
+	d.SetMaxMessageSize(len(frame))
+	d.SetMaxDecompressedSize(len(msg))
+	got, err := d.DecodeMessage()
+	if err != nil {
+		t.Fatalf("DecodeMessage() error: %v", err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("DecodeMessage() returned %d bytes, want %d", len(got), len(msg))
+	}
+}
@@ -0,0 +1,106 @@
+package wireformat
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// binSuffix marks metadata keys whose values are binary and sent base64 encoded
+const binSuffix = "-bin"
+
+// ValidateMetadataKey checks a custom metadata key against the spec's Header-Name
+// (lowercase letters, digits, '_', '-' and '.') and rejects the grpc- prefix and the
+// headers the protocol itself sends, such as content-type and te
+func ValidateMetadataKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("wireformat: empty metadata key")
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return fmt.Errorf("wireformat: invalid character %q in metadata key %q", c, key)
+		}
+	}
+	if strings.HasPrefix(key, "grpc-") {
+		return fmt.Errorf("wireformat: metadata key %q uses the reserved grpc- prefix", key)
+	}
+	if isReservedHeader(key) {
+		return fmt.Errorf("wireformat: metadata key %q is reserved for the protocol", key)
+	}
+	return nil
+}
+
+// AddMetadata validates key and adds it to h.  Values of -bin keys are base64
+// encoded; other values must be printable ASCII.
+func AddMetadata(h http.Header, key, value string) error {
+	key = strings.ToLower(key)
+	if err := ValidateMetadataKey(key); err != nil {
+		return err
+	}
+	if strings.HasSuffix(key, binSuffix) {
+		h.Add(key, base64.RawStdEncoding.EncodeToString([]byte(value)))
+		return nil
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < 0x20 || value[i] > 0x7e {
+			return fmt.Errorf("wireformat: metadata value for %q must be printable ASCII, use a %s key for binary", key, binSuffix)
+		}
+	}
+	h.Add(key, value)
+	return nil
+}
+
+// DecodeMetadata returns the custom metadata in a set of response headers or
+// trailers with -bin values decoded.  Headers that belong to the protocol
+// (content-type, grpc-status, ...) are left out.
+func DecodeMetadata(h http.Header) (metadata.MD, error) {
+	md := metadata.MD{}
+	for k, vs := range h {
+		k = strings.ToLower(k)
+		if isReservedHeader(k) {
+			continue
+		}
+		for _, v := range vs {
+			if strings.HasSuffix(k, binSuffix) {
+				b, err := decodeBinHeader(v)
+				if err != nil {
+					return nil, fmt.Errorf("wireformat: malformed %s metadata: %v", k, err)
+				}
+				v = string(b)
+			}
+			md[k] = append(md[k], v)
+		}
+	}
+	return md, nil
+}
+
+// isReservedHeader is true for headers gRPC itself uses
+func isReservedHeader(k string) bool {
+	switch k {
+	case "content-type",
+		"user-agent",
+		"te",
+		"grpc-message-type",
+		"grpc-encoding",
+		"grpc-accept-encoding",
+		"grpc-message",
+		"grpc-status",
+		"grpc-timeout",
+		"grpc-status-details-bin":
+		return true
+	}
+	return strings.HasPrefix(k, ":")
+}
+
+// decodeBinHeader decodes the base64 value of a -bin header.  Senders may
+// omit the padding so both forms are accepted.
+func decodeBinHeader(v string) ([]byte, error) {
+	if len(v)%4 == 0 {
+		return base64.StdEncoding.DecodeString(v)
+	}
+	return base64.RawStdEncoding.DecodeString(v)
+}
@@ -0,0 +1,108 @@
+package wireformat
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestValidateMetadataKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{"x-user", false},
+		{"x_user.id-2", false},
+		{"trace-bin", false},
+		{"", true},
+		{"X-User", true},
+		{"x user", true},
+		{":path", true},
+		{"grpc-foo", true},
+		{"grpc-timeout", true},
+		{"content-type", true},
+		{"te", true},
+		{"user-agent", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateMetadataKey(tt.key); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateMetadataKey(%q) error = %v, want error %v", tt.key, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAddMetadata(t *testing.T) {
+	tests := []struct {
+		key, value string
+		wantHeader string
+		wantErr    bool
+	}{
+		{key: "X-User", value: "sal", wantHeader: "sal"},
+		{key: "trace-bin", value: "\x00\x01\xff", wantHeader: "AAH/"},
+		{key: "trace-bin", value: "\x00\x01", wantHeader: "AAE"},
+		{key: "x-user", value: "tab\there", wantErr: true},
+		{key: "Content-Type", value: "text/plain", wantErr: true},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		err := AddMetadata(h, tt.key, tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("AddMetadata(%q, %q) error = %v, want error %v", tt.key, tt.value, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			if len(h) != 0 {
+				t.Errorf("AddMetadata(%q, %q) failed but set %v", tt.key, tt.value, h)
+			}
+			continue
+		}
+		if got := h.Get(tt.key); got != tt.wantHeader {
+			t.Errorf("AddMetadata(%q, %q) set %q, want %q", tt.key, tt.value, got, tt.wantHeader)
+		}
+
+		// the server sends -bin values back the same way, padded or not
+		md, err := DecodeMetadata(h)
+		if err != nil {
+			t.Fatalf("DecodeMetadata() error: %v", err)
+		}
+		if got := md.Get(tt.key); len(got) != 1 || got[0] != tt.value {
+			t.Errorf("DecodeMetadata() %s = %q, want %q", tt.key, got, tt.value)
+		}
+	}
+
+	padded := http.Header{"Trace-Bin": {"AAE="}, "Content-Type": {"application/grpc"}}
+	md, err := DecodeMetadata(padded)
+	if err != nil {
+		t.Fatalf("DecodeMetadata() error: %v", err)
+	}
+	if got := md.Get("trace-bin"); len(got) != 1 || got[0] != "\x00\x01" {
+		t.Errorf("DecodeMetadata() trace-bin = %q, want \"\\x00\\x01\"", got)
+	}
+	if len(md.Get("content-type")) != 0 {
+		t.Errorf("DecodeMetadata() kept content-type")
+	}
+	if _, err := DecodeMetadata(http.Header{"Trace-Bin": {"!!"}}); err == nil {
+		t.Errorf("DecodeMetadata() accepted a malformed -bin value")
+	}
+}
+
+func TestDecodeGrpcMessage(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"no escapes", "no escapes"},
+		{"100%25 sure", "100% sure"},
+		{"caf%C3%A9", "café"},
+		{"line%0Abreak", "line\nbreak"},
+		// not escapes, kept as they are
+		{"50%", "50%"},
+		{"%4", "%4"},
+		{"%zz done", "%zz done"},
+		{"%%41", "%A"},
+	}
+	for _, tt := range tests {
+		if got := decodeGrpcMessage(tt.in); got != tt.want {
+			t.Errorf("decodeGrpcMessage(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
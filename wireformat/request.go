@@ -0,0 +1,59 @@
+package wireformat
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxTimeoutValue is the largest value grpc-timeout allows: at most 8 digits
+const maxTimeoutValue int64 = 100000000 - 1
+
+var timeoutUnits = []struct {
+	unit byte
+	d    time.Duration
+}{
+	{'n', time.Nanosecond},
+	{'u', time.Microsecond},
+	{'m', time.Millisecond},
+	{'S', time.Second},
+	{'M', time.Minute},
+	{'H', time.Hour},
+}
+
+// NewRequest returns the POST for a gRPC call to url (https://host/package.Service/Method)
+// with the headers every call carries.  If ctx has a deadline it is sent as grpc-timeout
+// so the server can give up too; when the deadline passes the http2 transport resets
+// the stream and reads from the response body fail (see ContextError).
+func NewRequest(ctx context.Context, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("grpc-timeout", EncodeTimeout(time.Until(deadline)))
+	}
+	return req, nil
+}
+
+// EncodeTimeout formats d as a grpc-timeout value: the smallest unit (n, u, m, S, M, H)
+// that fits the timeout in 8 digits, rounding up
+func EncodeTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "0n"
+	}
+	for _, u := range timeoutUnits {
+		v := int64(d / u.d)
+		if d%u.d > 0 {
+			v++
+		}
+		if v <= maxTimeoutValue || u.unit == 'H' {
+			return strconv.FormatInt(v, 10) + string(u.unit)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+package wireformat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEncodeTimeout(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0n"},
+		{-time.Second, "0n"},
+		{1, "1n"},
+		{99999999, "99999999n"},
+		// 9 digits of nanoseconds move to microseconds
+		{100000000, "100000u"},
+		// a remainder smaller than the unit rounds up
+		{100000001, "100001u"},
+		{99999999 * time.Microsecond, "99999999u"},
+		{99999999*time.Microsecond + 1, "100000m"},
+		{time.Second, "1000000u"},
+		{99999999 * time.Millisecond, "99999999m"},
+		{100000000 * time.Millisecond, "100000S"},
+		{99999999 * time.Second, "99999999S"},
+		{99999999*time.Second + time.Millisecond, "1666667M"},
+		// the largest Duration still fits in hours
+		{time.Duration(1<<63 - 1), "2562048H"},
+	}
+	for _, tt := range tests {
+		if got := EncodeTimeout(tt.d); got != tt.want {
+			t.Errorf("EncodeTimeout(%d) = %q, want %q", int64(tt.d), got, tt.want)
+		}
+	}
+}
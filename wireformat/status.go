@@ -0,0 +1,151 @@
+package wireformat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// errorBodyPrefix is how much of a non-gRPC response body is quoted in the error
+const errorBodyPrefix = 256
+
+// HTTPStatusToCode maps the HTTP status of a response that didn't carry a
+// grpc-status to a gRPC code using the table in
+// https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md
+func HTTPStatusToCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
+
+// isGRPCContentType accepts application/grpc and its application/grpc+proto,
+// application/grpc;... variants
+func isGRPCContentType(ct string) bool {
+	if !strings.HasPrefix(ct, "application/grpc") {
+		return false
+	}
+	rest := ct[len("application/grpc"):]
+	return rest == "" || rest[0] == '+' || rest[0] == ';'
+}
+
+// CheckResponse verifies that resp came from a gRPC server: HTTP 200 with an
+// application/grpc content type.  Anything else, typically an HTML error page from
+// a proxy, is turned into a status error using HTTPStatusToCode with the start of
+// the body in the message.  Responses that carry grpc-status in their headers are
+// left for Status to interpret.
+func CheckResponse(resp *http.Response) error {
+	if resp.Header.Get("grpc-status") != "" {
+		return nil
+	}
+	ct := resp.Header.Get("Content-Type")
+	if resp.StatusCode == http.StatusOK && isGRPCContentType(ct) {
+		return nil
+	}
+
+	var msg []string
+	code := HTTPStatusToCode(resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		msg = append(msg, fmt.Sprintf("unexpected HTTP status code received from server: %d (%s)", resp.StatusCode, http.StatusText(resp.StatusCode)))
+	}
+	if !isGRPCContentType(ct) {
+		msg = append(msg, fmt.Sprintf("transport: received unexpected content-type %q", ct))
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyPrefix))
+	if len(body) > 0 {
+		msg = append(msg, fmt.Sprintf("body: %q", body))
+	}
+	return status.Error(code, strings.Join(msg, "; "))
+}
+
+// ContextError converts err, returned while making or reading a request that used
+// ctx, into a DEADLINE_EXCEEDED or CANCELLED status error if ctx is done.  Other
+// errors are returned unchanged.
+func ContextError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	return status.FromContextError(ctx.Err()).Err()
+}
+
+// Status returns the outcome of an RPC from the grpc-status and grpc-message
+// trailers.  For Trailers-Only responses (typically errors with no messages) Go's
+// http2 client exposes the trailers as ordinary headers so those are checked next.
+// The trailers are only populated once the response body has been read to EOF.
+//
+// If grpc-status-details-bin is present it is decoded as a google.rpc.Status and
+// its details are carried on the returned status; use st.Proto().Details to get
+// at the packed Any messages.
+func Status(header, trailer http.Header) *status.Status {
+	src := trailer
+	if src.Get("grpc-status") == "" {
+		src = header
+	}
+	s := src.Get("grpc-status")
+	if s == "" {
+		return status.New(codes.Internal, "grpc: server closed the stream without sending trailers")
+	}
+	code, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return status.Newf(codes.Internal, "grpc: malformed grpc-status %q: %v", s, err)
+	}
+	msg := decodeGrpcMessage(src.Get("grpc-message"))
+
+	details := src.Get("grpc-status-details-bin")
+	if details == "" {
+		return status.New(codes.Code(code), msg)
+	}
+	b, err := decodeBinHeader(details)
+	if err != nil {
+		return status.Newf(codes.Internal, "grpc: malformed grpc-status-details-bin: %v", err)
+	}
+	sp := &spb.Status{}
+	if err := proto.Unmarshal(b, sp); err != nil {
+		return status.Newf(codes.Internal, "grpc: malformed grpc-status-details-bin: %v", err)
+	}
+	if sp.Code != int32(code) {
+		return status.Newf(codes.Internal, "grpc: grpc-status-details-bin code %d does not match grpc-status %d", sp.Code, code)
+	}
+	return status.FromProto(sp)
+}
+
+// decodeGrpcMessage undoes the percent-encoding of grpc-message.  Sequences that
+// aren't valid %XX escapes are passed through untouched as the spec asks.
+func decodeGrpcMessage(msg string) string {
+	if !strings.Contains(msg, "%") {
+		return msg
+	}
+	var sb strings.Builder
+	sb.Grow(len(msg))
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c == '%' && i+2 < len(msg) {
+			v, err := strconv.ParseUint(msg[i+1:i+3], 16, 8)
+			if err == nil {
+				sb.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
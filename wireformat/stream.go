@@ -0,0 +1,70 @@
+package wireformat
+
+import (
+	"io"
+	"sync"
+)
+
+// RequestStream is an io.Pipe backed request body for client and bidi streaming
+// calls.  Pass it as the body of the http.Request and call Send from another
+// goroutine: the http2 transport copies each frame into DATA frames as it is
+// written.  CloseSend half-closes the stream by ending the body (END_STREAM),
+// after which the response can still be read.
+type RequestStream struct {
+	pr  *io.PipeReader
+	pw  *io.PipeWriter
+	enc *Encoder
+	mu  sync.Mutex
+}
+
+// NewRequestStream returns an open RequestStream
+func NewRequestStream() *RequestStream {
+	pr, pw := io.Pipe()
+	return &RequestStream{
+		pr:  pr,
+		pw:  pw,
+		enc: NewEncoder(pw),
+	}
+}
+
+// Encoder returns the Encoder used by Send so limits and compression can be set
+func (s *RequestStream) Encoder() *Encoder {
+	return s.enc
+}
+
+// Read implements io.Reader for the http.Request body
+func (s *RequestStream) Read(p []byte) (int, error) {
+	return s.pr.Read(p)
+}
+
+// Close implements io.Closer; the transport calls it once the body is done with
+func (s *RequestStream) Close() error {
+	return s.pr.Close()
+}
+
+// Send frames and writes one serialized message.  It blocks until the transport
+// has consumed the frame.  If the message can't be sent (eg it is larger than
+// the Encoder's limit) the stream is aborted with the error, otherwise the
+// server would wait forever for the rest of the body.  Send is safe for
+// concurrent use.
+func (s *RequestStream) Send(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.enc.EncodeMessage(msg)
+	if err != nil {
+		s.pw.CloseWithError(err)
+	}
+	return err
+}
+
+// CloseSend half-closes the request stream
+func (s *RequestStream) CloseSend() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pw.Close()
+}
+
+// CloseWithError aborts the request stream; the transport resets the HTTP/2 stream
+func (s *RequestStream) CloseWithError(err error) {
+	s.pw.CloseWithError(err)
+}